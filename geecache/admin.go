@@ -0,0 +1,249 @@
+/*
+ * @Description:管理接口，返回JSON。所有请求都要先通过SetAdminAuth设置的鉴权，没有设置时管理接口不可用。
+ * GET    /_geecache/_admin/groups                    所有分组及其大小
+ * GET    /_geecache/_admin/groups/<group>            一个分组的大小
+ * DELETE /_geecache/_admin/groups/<group>            清空本节点上该分组的缓存
+ * GET    /_geecache/_admin/groups/<group>/keys       列出内存中的key，?prefix=只列出该前缀的key，?limit=最多列出的条数
+ * GET    /_geecache/_admin/groups/<group>/keys/<key> 查看缓存值，不影响淘汰顺序
+ * DELETE /_geecache/_admin/groups/<group>/keys/<key> 删除本节点上的缓存
+ * GET    /_geecache/_admin/ring?key=<key>            负责key的节点
+ * GET    /_geecache/_admin/stats                     统计信息，同_stats
+ * 管理接口的鉴权只保护管理接口。节点之间的写入（PUT）、删除（DELETE /_geecache/<group>/<key>）和失效广播（_invalidate）
+ * 由SetPeerToken设置的令牌保护，没有设置时任何能访问节点的人都可以修改缓存
+ * @version:
+ * @Author: Steven
+ * @Date: 2023-05-08 21:03:17
+ */
+package geecache
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	adminPath         = "_admin/"
+	defaultAdminLimit = 1000 //列出key时默认最多返回的条数
+)
+
+// SetAdminAuth enables the admin API of the pool under basePath+"_admin/",
+// allowing the requests for which auth returns true. The admin API is
+// disabled until it is called. It must be called before serving.
+func (p *HTTPPool) SetAdminAuth(auth func(r *http.Request) bool) {
+	p.adminAuth = auth
+}
+
+// SetPeerToken makes the pool require "Authorization: Bearer <token>" on
+// the requests that change its caches: the PUT and DELETE of a key sent
+// by peers and the invalidations they publish. The pool sends token with
+// its own such requests, so every node must use the same token. Reads
+// stay open. SetAdminAuth doesn't cover these requests; without a peer
+// token anyone who can reach the pool can change its caches. It must be
+// called before Set and serving.
+func (p *HTTPPool) SetPeerToken(token string) {
+	p.peerToken = token
+}
+
+// 检查节点请求的令牌，不通过时返回401
+func (p *HTTPPool) checkPeer(w http.ResponseWriter, r *http.Request) bool {
+	if p.peerToken == "" || subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+p.peerToken)) == 1 {
+		return true
+	}
+	http.Error(w, "unauthorized", http.StatusUnauthorized)
+	return false
+}
+
+// 给发往其他节点的请求带上令牌
+func setPeerToken(r *http.Request, token string) {
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+}
+
+// BearerToken returns an admin auth check that allows requests with an
+// "Authorization: Bearer <token>" header.
+func BearerToken(token string) func(r *http.Request) bool {
+	expect := []byte("Bearer " + token)
+	return func(r *http.Request) bool {
+		return subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expect) == 1
+	}
+}
+
+// 分组的大小
+type groupInfo struct {
+	Name      string
+	MainCache CacheStats
+	HotCache  CacheStats
+}
+
+// 一条缓存
+type keyInfo struct {
+	Key     string
+	Cache   string     //main或者hot
+	Bytes   int        `json:",omitempty"`
+	Expire  *time.Time `json:",omitempty"` //永不过期时没有该字段
+	Version uint64     `json:",omitempty"`
+	Value   []byte     `json:",omitempty"` //只有查看单个key时才返回
+}
+
+// 节点是否负责key
+type ownerInfo struct {
+	Peer    string
+	Self    bool
+	Healthy bool
+}
+
+func (p *HTTPPool) serveAdmin(w http.ResponseWriter, r *http.Request, path string) {
+	if p.adminAuth == nil {
+		http.Error(w, "admin API is disabled", http.StatusForbidden)
+		return
+	}
+	if !p.adminAuth(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	switch {
+	case path == "stats" && r.Method == http.MethodGet:
+		p.serveStats(w, r)
+	case path == "ring" && r.Method == http.MethodGet:
+		key := r.URL.Query().Get("key")
+		if key == "" {
+			http.Error(w, "key is required", http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, p.owners(key))
+	case path == "groups" && r.Method == http.MethodGet:
+		groups := p.cache.Groups()
+		infos := make([]groupInfo, len(groups))
+		for i, g := range groups {
+			infos[i] = infoOf(g)
+		}
+		writeJSON(w, infos)
+	case strings.HasPrefix(path, "groups/"):
+		// groups/<group>[/keys[/<key>]]，key中可以有/
+		parts := strings.SplitN(path[len("groups/"):], "/", 3)
+		g := p.cache.GetGroup(parts[0])
+		if g == nil {
+			http.Error(w, "no such group: "+parts[0], http.StatusNotFound)
+			return
+		}
+		switch {
+		case len(parts) == 1:
+			p.serveAdminGroup(w, r, g)
+		case parts[1] != "keys":
+			http.NotFound(w, r)
+		case len(parts) == 2:
+			p.serveAdminKeys(w, r, g)
+		default:
+			p.serveAdminKey(w, r, g, parts[2])
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (p *HTTPPool) serveAdminGroup(w http.ResponseWriter, r *http.Request, g *Group) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, infoOf(g))
+	case http.MethodDelete: //只清空本节点，整个集群用InvalidateGroup
+		n := g.removeFuncLocally(func(string) bool { return true })
+		writeJSON(w, map[string]int{"Purged": n})
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// 按淘汰顺序列出主缓存和热点缓存中的key，遍历不影响淘汰顺序
+func (p *HTTPPool) serveAdminKeys(w http.ResponseWriter, r *http.Request, g *Group) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	prefix := r.URL.Query().Get("prefix")
+	limit := defaultAdminLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "bad limit: "+v, http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	keys := []keyInfo{}
+	collect := func(cache string) func(key string, value ByteView) {
+		return func(key string, value ByteView) {
+			if len(keys) < limit && strings.HasPrefix(key, prefix) {
+				keys = append(keys, keyInfoOf(key, cache, value))
+			}
+		}
+	}
+	g.mainCache.walk(collect("main"))
+	g.hotCache.walk(collect("hot"))
+	writeJSON(w, keys)
+}
+
+func (p *HTTPPool) serveAdminKey(w http.ResponseWriter, r *http.Request, g *Group, key string) {
+	switch r.Method {
+	case http.MethodGet:
+		cache := "main"
+		value, ok := g.mainCache.peek(key)
+		if !ok {
+			cache = "hot"
+			value, ok = g.hotCache.peek(key)
+		}
+		if !ok {
+			http.Error(w, "no such key: "+key, http.StatusNotFound)
+			return
+		}
+		info := keyInfoOf(key, cache, value)
+		info.Value = value.b
+		writeJSON(w, info)
+	case http.MethodDelete: //只删除本节点，整个集群用Invalidate
+		g.removeLocally(key)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// 按hash环顺时针找到的负责key的节点，包括熔断的节点
+func (p *HTTPPool) owners(key string) []ownerInfo {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	owners := []ownerInfo{}
+	if p.peers == nil {
+		return owners
+	}
+	for _, peer := range p.peers.GetN(key, p.replication) {
+		info := ownerInfo{Peer: peer, Self: peer == p.self, Healthy: true}
+		if getter, ok := p.httpGetters[peer]; ok && !info.Self {
+			info.Healthy = getter.health.healthy()
+		}
+		owners = append(owners, info)
+	}
+	return owners
+}
+
+func infoOf(g *Group) groupInfo {
+	return groupInfo{Name: g.name, MainCache: g.CacheStats(MainCache), HotCache: g.CacheStats(HotCache)}
+}
+
+func keyInfoOf(key string, cache string, value ByteView) keyInfo {
+	info := keyInfo{Key: key, Cache: cache, Bytes: value.Len(), Version: value.v}
+	if !value.e.IsZero() {
+		e := value.e
+		info.Expire = &e
+	}
+	return info
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
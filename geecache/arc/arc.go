@@ -0,0 +1,250 @@
+/*
+ * @Description:ARC淘汰策略，同时维护最近访问(T1)和频繁访问(T2)两个队列，
+ * 并根据幽灵队列(B1/B2)的命中情况，自适应地调整两个队列各自可以使用的内存
+ * @version:
+ * @Author: Steven
+ * @Date: 2023-04-10 14:36:02
+ */
+package arc
+
+import (
+	"container/list"
+	"geecache/lru"
+	"time"
+)
+
+// Value use Len to count how many bytes it takes
+type Value = lru.Value
+
+// Cache is an ARC cache sized in bytes. It is not safe for concurrent access.
+type Cache struct {
+	maxBytes int64 //最大可以使用的内存
+	p        int64 //T1的目标内存大小，由幽灵队列的命中情况自适应调整
+
+	t1, t2 *queue //t1:只访问过一次的缓存；t2:访问过至少两次的缓存
+	b1, b2 *queue //幽灵队列，只记录最近从t1、t2淘汰的key和大小，不保存值
+
+	cache map[string]*list.Element //key到四个队列中节点的映射
+	// optional and executed when an entry is purged.
+	OnEvicted func(key string, value Value)
+}
+
+type entry struct {
+	key    string
+	value  Value     //幽灵节点的value为nil
+	size   int64     //key和value占用的内存，幽灵节点也保留该大小
+	expire time.Time //过期时间，零值代表永不过期
+	q      *queue    //所在的队列
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.expire.IsZero() && !now.Before(e.expire)
+}
+
+// 一个带有内存统计的双向链表，队首是最近访问的
+type queue struct {
+	ll     *list.List
+	nbytes int64
+}
+
+func newQueue() *queue {
+	return &queue{ll: list.New()}
+}
+
+func (q *queue) pushFront(e *entry) *list.Element {
+	e.q = q
+	q.nbytes += e.size
+	return q.ll.PushFront(e)
+}
+
+func (q *queue) remove(ele *list.Element) *entry {
+	e := q.ll.Remove(ele).(*entry)
+	q.nbytes -= e.size
+	return e
+}
+
+// New is the Constructor of Cache
+func New(maxBytes int64, onEvicted func(string, Value)) *Cache {
+	return &Cache{
+		maxBytes:  maxBytes,
+		t1:        newQueue(),
+		t2:        newQueue(),
+		b1:        newQueue(),
+		b2:        newQueue(),
+		cache:     make(map[string]*list.Element),
+		OnEvicted: onEvicted,
+	}
+}
+
+// Add adds a value to the cache.
+func (c *Cache) Add(key string, value Value) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+// AddWithExpire adds a value to the cache which expires at the given time.
+// A zero expire means the value never expires.
+func (c *Cache) AddWithExpire(key string, value Value, expire time.Time) {
+	size := int64(len(key)) + int64(value.Len())
+	ele, ok := c.cache[key]
+	if !ok { //全新的key，放入t1
+		c.cache[key] = c.t1.pushFront(&entry{key: key, value: value, size: size, expire: expire})
+		c.replace(false)
+		return
+	}
+
+	e := ele.Value.(*entry)
+	fromB2 := false
+	switch e.q {
+	case c.b1: //最近被淘汰的只访问过一次的缓存又来了，说明t1太小
+		c.p = min(c.maxBytes, c.p+max(c.b2.nbytes/max(c.b1.nbytes, 1), 1)*size)
+	case c.b2: //最近被淘汰的频繁访问的缓存又来了，说明t2太小
+		c.p = max(0, c.p-max(c.b1.nbytes/max(c.b2.nbytes, 1), 1)*size)
+		fromB2 = true
+	}
+	//不论之前在哪个队列，再次写入都说明至少访问了两次，放入t2
+	e.q.remove(ele)
+	e.value, e.size, e.expire = value, size, expire
+	c.cache[key] = c.t2.pushFront(e)
+	c.replace(fromB2)
+}
+
+// 内存超出限制时，根据p从t1或者t2淘汰缓存到对应的幽灵队列
+func (c *Cache) replace(fromB2 bool) {
+	if c.maxBytes == 0 {
+		return
+	}
+	for c.t1.nbytes+c.t2.nbytes > c.maxBytes {
+		if c.t1.nbytes > 0 && (c.t1.nbytes > c.p || (fromB2 && c.t1.nbytes == c.p) || c.t2.nbytes == 0) {
+			c.evict(c.t1, c.b1)
+		} else {
+			c.evict(c.t2, c.b2)
+		}
+	}
+	//幽灵队列只保存key，也要限制大小：t1+b1不超过maxBytes，四个队列一共不超过2倍maxBytes
+	for c.b1.nbytes > 0 && c.t1.nbytes+c.b1.nbytes > c.maxBytes {
+		c.dropGhost(c.b1)
+	}
+	for c.b2.nbytes > 0 && c.t1.nbytes+c.t2.nbytes+c.b1.nbytes+c.b2.nbytes > 2*c.maxBytes {
+		c.dropGhost(c.b2)
+	}
+}
+
+// 淘汰from队尾的缓存，只把key记录到幽灵队列ghost中
+func (c *Cache) evict(from, ghost *queue) {
+	e := from.remove(from.ll.Back())
+	value := e.value
+	e.value = nil
+	c.cache[e.key] = ghost.pushFront(e)
+	if c.OnEvicted != nil {
+		c.OnEvicted(e.key, value)
+	}
+}
+
+func (c *Cache) dropGhost(ghost *queue) {
+	e := ghost.remove(ghost.ll.Back())
+	delete(c.cache, e.key)
+}
+
+// Get look ups a key's value
+func (c *Cache) Get(key string) (value Value, ok bool) {
+	ele, ok := c.cache[key]
+	if !ok {
+		return
+	}
+	e := ele.Value.(*entry)
+	if e.q == c.b1 || e.q == c.b2 { //幽灵节点没有值
+		return nil, false
+	}
+	if e.expired(time.Now()) {
+		c.removeElement(ele)
+		return nil, false
+	}
+	e.q.remove(ele) //访问了两次，放入t2的队首
+	c.cache[key] = c.t2.pushFront(e)
+	return e.value, true
+}
+
+// Peek returns the value of key and its expire time without updating
+// its recency or frequency, and without removing it if it has expired.
+func (c *Cache) Peek(key string) (value Value, expire time.Time, ok bool) {
+	ele, ok := c.cache[key]
+	if !ok {
+		return
+	}
+	e := ele.Value.(*entry)
+	if e.q == c.b1 || e.q == c.b2 || e.expired(time.Now()) {
+		return nil, time.Time{}, false
+	}
+	return e.value, e.expire, true
+}
+
+// Remove removes the provided key from the cache.
+func (c *Cache) Remove(key string) {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele)
+	}
+}
+
+// RemoveExpired removes all expired items and returns how many were removed.
+func (c *Cache) RemoveExpired() int {
+	now := time.Now()
+	n := 0
+	for _, q := range []*queue{c.t1, c.t2} {
+		for ele := q.ll.Back(); ele != nil; {
+			prev := ele.Prev()
+			if ele.Value.(*entry).expired(now) {
+				c.removeElement(ele)
+				n++
+			}
+			ele = prev
+		}
+	}
+	return n
+}
+
+// Walk calls fn for every unexpired item, those seen once before those
+// seen twice, each from the oldest to the newest. Ghost entries are
+// skipped. fn must not modify the cache.
+func (c *Cache) Walk(fn func(key string, value Value, expire time.Time)) {
+	now := time.Now()
+	for _, q := range []*queue{c.t1, c.t2} {
+		for ele := q.ll.Back(); ele != nil; ele = ele.Prev() {
+			if e := ele.Value.(*entry); !e.expired(now) {
+				fn(e.key, e.value, e.expire)
+			}
+		}
+	}
+}
+
+func (c *Cache) removeElement(ele *list.Element) {
+	e := ele.Value.(*entry)
+	e.q.remove(ele)
+	delete(c.cache, e.key)
+	if e.value != nil && c.OnEvicted != nil { //幽灵节点已经回调过了
+		c.OnEvicted(e.key, e.value)
+	}
+}
+
+// Len returns the number of items in the cache, not counting ghost entries.
+func (c *Cache) Len() int {
+	return c.t1.ll.Len() + c.t2.ll.Len()
+}
+
+// Bytes returns the number of bytes used by keys and values in the cache.
+func (c *Cache) Bytes() int64 {
+	return c.t1.nbytes + c.t2.nbytes
+}
+
+func min(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,102 @@
+/*
+ * @Description:
+ * @version:
+ * @Author: Steven
+ * @Date: 2023-04-10 16:20:11
+ */
+package arc
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+func TestGet(t *testing.T) {
+	arc := New(int64(0), nil)
+	arc.Add("key1", String("1234"))
+	if v, ok := arc.Get("key1"); !ok || string(v.(String)) != "1234" {
+		t.Fatalf("cache hit key1=1234 failed")
+	}
+	if _, ok := arc.Get("key2"); ok {
+		t.Fatalf("cache miss key2 failed")
+	}
+}
+
+func TestOnEvicted(t *testing.T) {
+	keys := make([]string, 0)
+	callback := func(key string, value Value) {
+		keys = append(keys, key)
+	}
+	arc := New(int64(10), callback)
+	arc.Add("key1", String("123456"))
+	arc.Add("k2", String("k2"))
+	arc.Add("k3", String("k3"))
+	arc.Add("k4", String("k4"))
+
+	expect := []string{"key1", "k2"}
+
+	if !reflect.DeepEqual(expect, keys) {
+		t.Fatalf("Call OnEvicted failed, expect keys equals to %s, got %s", expect, keys)
+	}
+}
+
+func TestScanResistance(t *testing.T) {
+	arc := New(int64(100), nil)
+	for i := 0; i < 5; i++ { // 5 hot keys of 4 bytes each, used twice so they live in T2
+		arc.Add("hot"+strconv.Itoa(i), String("v"))
+		arc.Get("hot" + strconv.Itoa(i))
+	}
+	for i := 0; i < 1000; i++ { // a one-off scan only churns T1
+		arc.Add("scan"+strconv.Itoa(i), String("v"))
+	}
+	for i := 0; i < 5; i++ {
+		if _, ok := arc.Get("hot" + strconv.Itoa(i)); !ok {
+			t.Fatalf("hot%d was flushed by the scan", i)
+		}
+	}
+	if arc.Bytes() > 100 {
+		t.Fatalf("cache uses %d bytes, more than 100", arc.Bytes())
+	}
+}
+
+func TestGhostHit(t *testing.T) {
+	arc := New(int64(12), nil)
+	arc.Add("k1", String("v1"))
+	arc.Add("k2", String("v2"))
+	arc.Get("k2") // k2 moves to T2
+	arc.Add("k3", String("v3"))
+	arc.Add("k4", String("v4")) // k1 is evicted into the B1 ghost list
+
+	if _, ok := arc.Get("k1"); ok {
+		t.Fatalf("ghost entry k1 should be a miss")
+	}
+	arc.Add("k1", String("v1")) // a ghost hit grows the T1 target
+	if arc.p == 0 {
+		t.Fatalf("ghost hit in B1 should increase p")
+	}
+	if _, ok := arc.Get("k1"); !ok || arc.Len() != 3 {
+		t.Fatalf("k1 should be cached again")
+	}
+}
+
+func TestExpire(t *testing.T) {
+	arc := New(int64(0), nil)
+	arc.AddWithExpire("key1", String("1234"), time.Now().Add(-time.Second))
+	arc.AddWithExpire("key2", String("5678"), time.Now().Add(-time.Second))
+	arc.Add("key3", String("90"))
+
+	if _, ok := arc.Get("key1"); ok || arc.Len() != 2 {
+		t.Fatalf("expired key1 should be a miss and removed")
+	}
+	if n := arc.RemoveExpired(); n != 1 || arc.Len() != 1 {
+		t.Fatalf("RemoveExpired removed %d, %d left", n, arc.Len())
+	}
+}
@@ -0,0 +1,201 @@
+/*
+ * @Description:批量获取缓存，按节点分组之后每个节点只发送一次请求
+ * @version:
+ * @Author: Steven
+ * @Date: 2023-04-17 21:08:33
+ */
+package geecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// A Result is the outcome of looking up one key with GetMany.
+type Result struct {
+	Key   string
+	Value ByteView
+	Err   error
+}
+
+// 回调函数如果可以一次加载多个key，比如一条SQL查询多行，就实现BatchGetter接口
+// A BatchGetter loads data for many keys at once. values and errs must
+// have the same length as keys; errs[i] reports the failure of keys[i].
+type BatchGetter interface {
+	GetMany(ctx context.Context, keys []string) (values [][]byte, errs []error)
+}
+
+// GetMany looks up many keys at once. Cache misses are grouped by the
+// peer owning them, each peer gets one batched request in parallel, and
+// keys owned by this node are loaded through a BatchGetter if the group's
+// Getter implements it. Results are in the order of keys.
+func (g *Group) GetMany(keys []string) []Result {
+	return g.GetManyContext(context.Background(), keys)
+}
+
+// GetManyContext is like GetMany with a context.
+func (g *Group) GetManyContext(ctx context.Context, keys []string) []Result {
+	results := make([]Result, len(keys))
+	var local []int                       //本节点负责的key在keys中的下标
+	remote := make(map[PeerGetter][]int)  //远程节点负责的key，按节点分组
+	primary := make(map[PeerGetter][]int) //本节点是副本的key，从第一个节点加载，按节点分组
+	for i, key := range keys {
+		results[i].Key = key
+		if key == "" {
+			results[i].Err = fmt.Errorf("key is required")
+			continue
+		}
+		g.Stats.Gets.Add(1)
+		if v, hit, err := g.lookup(key); hit {
+			results[i].Value, results[i].Err = v, err
+			continue
+		}
+		g.Stats.Loads.Add(1)
+		peers, isLocal := g.pickPeers(key)
+		if !isLocal { //有多个副本时总是找第一个，同一个节点的key才能合并成一次请求
+			remote[peers[0]] = append(remote[peers[0]], i)
+			continue
+		}
+		if len(peers) > 0 && !fromPeer(ctx) { //和load一样，副本从第一个节点加载，所有副本上的版本都相同
+			if peer, self := g.pickPrimary(key); !self {
+				primary[peer] = append(primary[peer], i)
+				continue
+			}
+		}
+		local = append(local, i)
+	}
+
+	var wg sync.WaitGroup
+	for peer, idx := range remote { //并发向每个节点发送一次请求
+		wg.Add(1)
+		go func(peer PeerGetter, idx []int) {
+			defer wg.Done()
+			g.getManyFromPeer(ctx, peer, keys, idx, results, false)
+		}(peer, idx)
+	}
+	for peer, idx := range primary {
+		wg.Add(1)
+		go func(peer PeerGetter, idx []int) {
+			defer wg.Done()
+			g.getManyFromPeer(ctx, peer, keys, idx, results, true)
+		}(peer, idx)
+	}
+	g.getManyLocally(ctx, keys, local, results)
+	wg.Wait()
+	return results
+}
+
+// 从一个远程节点批量获取，节点不支持批量获取或者获取失败的key，逐个走load，失败时会从本地加载。
+// owner为true时本节点是这些key的副本，peer是第一个节点，获取到的值带着它的版本写入主缓存
+func (g *Group) getManyFromPeer(ctx context.Context, peer PeerGetter, keys []string, idx []int, results []Result, owner bool) {
+	bp, ok := peer.(BatchPeerGetter)
+	if !ok {
+		for _, i := range idx {
+			results[i].Value, results[i].Err = g.load(ctx, keys[i])
+		}
+		return
+	}
+
+	cache := &g.hotCache
+	if owner {
+		cache = &g.mainCache
+	}
+	batch := make([]string, len(idx))
+	epochs := make([]uint64, len(idx))
+	negEpochs := make([]uint64, len(idx))
+	for j, i := range idx {
+		batch[j] = keys[i]
+		epochs[j] = cache.currentEpoch(keys[i])
+		negEpochs[j] = g.negCache.currentEpoch(keys[i])
+	}
+	got, err := bp.GetMany(ctx, g.name, batch)
+	if err == nil && len(got) != len(batch) {
+		err = fmt.Errorf("peer returned %d results for %d keys", len(got), len(batch))
+	}
+	if err != nil {
+		g.Stats.PeerErrors.Add(1)
+		log.Println("[GeeCache] Failed to get many from peer", err)
+	}
+	for j, i := range idx {
+		if err == nil && got[j].Err == nil {
+			g.Stats.PeerLoads.Add(1)
+			if owner {
+				observeVersion(got[j].Value.v)
+				g.populateCache(keys[i], got[j].Value, epochs[j])
+			} else {
+				g.populateHotCache(keys[i], got[j].Value, epochs[j])
+			}
+			results[i].Value = got[j].Value
+			continue
+		}
+		if err == nil && errors.Is(got[j].Err, ErrNotFound) { //节点已经查过数据源了
+			g.Stats.PeerLoads.Add(1)
+			g.populateNegative(keys[i], got[j].Err, negEpochs[j])
+			results[i].Err = got[j].Err
+			continue
+		}
+		if ctx.Err() != nil { //请求已经取消，不用再从本地加载了
+			results[i].Err = ctx.Err()
+			continue
+		}
+		results[i].Value, results[i].Err = g.getLocallyOnce(ctx, keys[i])
+	}
+}
+
+// 批量从本地加载，回调函数不支持批量加载时逐个加载
+func (g *Group) getManyLocally(ctx context.Context, keys []string, idx []int, results []Result) {
+	if len(idx) == 0 {
+		return
+	}
+	bg, ok := g.getter.(BatchGetter)
+	if !ok {
+		for _, i := range idx {
+			results[i].Value, results[i].Err = g.getLocallyOnce(ctx, keys[i])
+		}
+		return
+	}
+
+	batch := make([]string, len(idx))
+	epochs := make([]uint64, len(idx))
+	versions := make([]uint64, len(idx))
+	negEpochs := make([]uint64, len(idx))
+	for j, i := range idx {
+		batch[j] = keys[i]
+		epochs[j] = g.mainCache.currentEpoch(keys[i])
+		versions[j] = nextVersion() //和getLocally一样，开始加载时就分配版本
+		negEpochs[j] = g.negCache.currentEpoch(keys[i])
+	}
+	values, errs := bg.GetMany(ctx, batch)
+	for j, i := range idx {
+		switch {
+		case j >= len(values) || j >= len(errs):
+			results[i].Err = fmt.Errorf("getter returned too few results for %s", keys[i])
+		case errs[j] != nil:
+			results[i].Err = errs[j]
+			g.populateNegative(keys[i], errs[j], negEpochs[j])
+		default:
+			results[i].Value = g.newView(values[j], 0)
+			results[i].Value.v = versions[j]
+			g.populateCache(keys[i], results[i].Value, epochs[j])
+		}
+		if results[i].Err != nil {
+			g.Stats.LocalLoadErrs.Add(1)
+		} else {
+			g.Stats.LocalLoads.Add(1)
+		}
+	}
+}
+
+// 从本地加载一个key，同样经过singleflight，避免和并发的Get重复加载
+func (g *Group) getLocallyOnce(ctx context.Context, key string) (ByteView, error) {
+	viewi, err := g.loader.DoContext(ctx, key, func(ctx context.Context) (interface{}, error) {
+		return g.loadLocally(ctx, key)
+	})
+	if err != nil {
+		return ByteView{}, err
+	}
+	return viewi.(ByteView), nil
+}
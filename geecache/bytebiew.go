@@ -6,9 +6,33 @@
  */
 package geecache
 
+import (
+	"sync/atomic"
+	"time"
+)
+
+// 最近分配的版本，从启动时间开始，节点重启之后分配的版本依然比重启之前的大
+var lastVersion = uint64(time.Now().UnixNano())
+
+func nextVersion() uint64 {
+	return atomic.AddUint64(&lastVersion, 1)
+}
+
+// 恢复了保存下来的版本之后，之后分配的版本要比它大，即使时钟被往回调过
+func observeVersion(v uint64) {
+	for {
+		last := atomic.LoadUint64(&lastVersion)
+		if v <= last || atomic.CompareAndSwapUint64(&lastVersion, last, v) {
+			return
+		}
+	}
+}
+
 // A ByteView holds an immutable view of bytes.
 type ByteView struct {
-	b []byte //缓存值，为什么不用字符串，因为还可以支持存储图片
+	b []byte    //缓存值，为什么不用字符串，因为还可以支持存储图片
+	e time.Time //过期时间，零值代表永不过期
+	v uint64    //版本，所属节点每次加载或写入都会分配一个更大的版本
 }
 
 // Len returns the view's length
@@ -16,6 +40,24 @@ func (v ByteView) Len() int { //既然处理缓存值，那么必然得实现缓
 	return len(v.b)
 }
 
+// Expire returns the view's expire time, or the zero time if it never expires.
+func (v ByteView) Expire() time.Time {
+	return v.e
+}
+
+// Version returns the version the owner of the key assigned to the value
+// when it was loaded or set. Pass it to Group.CompareAndSet to replace
+// the value only if nobody else has done so since. It is 0 if the value
+// came from a peer that does not support versions.
+func (v ByteView) Version() uint64 {
+	return v.v
+}
+
+// 已经过期，开启了后台刷新时过期的值还会在缓存中留一段时间
+func (v ByteView) stale() bool {
+	return !v.e.IsZero() && !time.Now().Before(v.e)
+}
+
 // ByteSlice returns a copy of the data as a byte slice.
 func (v ByteView) ByteSlice() []byte {
 	return cloneBytes(v.b) //返回一个拷贝，防止缓存值被修改
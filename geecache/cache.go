@@ -7,35 +7,279 @@
 package geecache
 
 import (
+	"geecache/disk"
 	"geecache/lru"
+	"log"
 	"sync"
+	"time"
 )
 
+const maxChangedKeys = 1024 //每个分片最多记录多少个变化过的key
+
 type cache struct {
 	mu         sync.Mutex //分布式锁
-	lru        *lru.Cache //存储缓存的源，即最底层负责缓存更新，淘汰策略的！
+	store      Policy     //存储缓存的源，即最底层负责缓存更新，淘汰策略的！
+	policy     PolicyType //淘汰策略，默认LRU
 	cacheBytes int64      //缓存大小
+	//每删除或者写入一次缓存加1，用来判断加载期间key是否被删除过。
+	//changed记录每个key最后一次变化时的epoch，加载开始之后key变化过，加载到的值就不能写入，
+	//其他key的加载不受影响。changed太大时清空，并把floor设为当前epoch，之前开始的加载都不能写入
+	epoch      uint64
+	changed    map[string]uint64
+	floor      uint64
+	nget, nhit int64 //查询次数与命中次数
+	nevict     int64 //被淘汰的缓存条数
+	//磁盘缓存层，不为nil时，被淘汰的缓存降级到磁盘，内存没有命中时再从磁盘找。
+	//一个key只会在内存和磁盘中的一处
+	disk     *disk.Store
+	removing bool //正在删除缓存，淘汰回调不需要降级到磁盘
+	//过期之后在内存中多保留的时间，期间返回过期的值并在后台刷新
+	stale time.Duration
+}
+
+// CacheStats are returned by stats accessors on Group.
+type CacheStats struct {
+	Bytes     int64
+	Items     int64
+	Gets      int64
+	Hits      int64
+	Evictions int64
 }
 
 func (c *cache) add(key string, value ByteView) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	if c.lru == nil {
-		c.lru = lru.New(c.cacheBytes, nil) //延迟初始化，即在第一次调用add方法时，才进行初始化
+	c.addLocked(key, value)
+}
+
+// 调用前必须持有c.mu
+func (c *cache) addLocked(key string, value ByteView) {
+	if c.store == nil {
+		//延迟初始化，即在第一次调用add方法时，才进行初始化
+		c.store = newPolicy(c.policy, c.cacheBytes, c.onEvicted)
+	}
+	if old, _, ok := c.store.Peek(key); ok && value.v != 0 && old.(ByteView).v > value.v {
+		return //已经有更新的值了，比如比它晚开始的加载先完成了
+	}
+	c.putLocked(key, value)
+}
+
+// 写入缓存，不比较版本，调用前必须持有c.mu
+func (c *cache) putLocked(key string, value ByteView) {
+	if c.store == nil {
+		c.store = newPolicy(c.policy, c.cacheBytes, c.onEvicted)
+	}
+	if c.disk != nil { //新的值在内存里，磁盘上的旧值作废
+		c.disk.Delete(key)
+	}
+	expire := value.e
+	if !expire.IsZero() {
+		expire = expire.Add(c.stale) //ByteView中依然是真正的过期时间
 	}
-	c.lru.Add(key, value)
+	c.store.AddWithExpire(key, value, expire)
+}
+
+// 淘汰发生在store的方法里，此时已经持有c.mu
+func (c *cache) onEvicted(key string, value lru.Value) {
+	c.nevict++
+	if c.disk == nil || c.removing {
+		return
+	}
+	v := value.(ByteView)
+	if !v.e.IsZero() && !time.Now().Before(v.e) { //过期的缓存不需要降级
+		return
+	}
+	if err := c.disk.Put(key, v.b, v.e, v.v); err != nil {
+		log.Printf("[GeeCache] failed to demote %s to disk: %v", key, err)
+	}
+}
+
+// 返回当前的epoch，加载缓存值之前调用，配合addIfEpoch使用
+func (c *cache) currentEpoch() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.epoch
+}
+
+// 只有在epoch之后key没有变化过时才写入，防止删除之前就开始的加载把旧值又写回缓存
+func (c *cache) addIfEpoch(key string, value ByteView, epoch uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if epoch < c.floor || c.changed[key] > epoch {
+		return
+	}
+	c.addLocked(key, value)
+}
+
+// 记录key发生了变化，调用前必须持有c.mu
+func (c *cache) changeLocked(key string) {
+	c.epoch++
+	if len(c.changed) >= maxChangedKeys {
+		c.changeAllLocked()
+		return
+	}
+	if c.changed == nil {
+		c.changed = make(map[string]uint64)
+	}
+	c.changed[key] = c.epoch
+}
+
+// 记录所有key都发生了变化，调用前必须持有c.mu
+func (c *cache) changeAllLocked() {
+	c.epoch++
+	c.floor = c.epoch
+	c.changed = nil
+}
+
+// 写入新值，同时记录key的变化，之前开始的加载拿到的旧值不会覆盖新值。
+// 负责key的节点持有key的写锁写入，不比较版本，写入的值总是最新的
+func (c *cache) set(key string, value ByteView) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.changeLocked(key)
+	c.putLocked(key, value)
+}
+
+// 副本写入负责节点发来的值，只有版本比缓存中的新才写入，返回缓存中保留的版本。
+// 同一个key并发的写入以不同的顺序到达各个副本时，所有副本最终保留的都是版本最大的值
+func (c *cache) setIfNewer(key string, value ByteView) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.store != nil {
+		if old, _, ok := c.store.Peek(key); ok && old.(ByteView).v >= value.v {
+			return old.(ByteView).v
+		}
+	}
+	if c.disk != nil {
+		if _, _, version, ok := c.disk.Get(key); ok && version >= value.v {
+			return version
+		}
+	}
+	c.changeLocked(key)
+	c.putLocked(key, value)
+	return value.v
+}
+
+func (c *cache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.changeLocked(key)
+	if c.disk != nil {
+		c.disk.Delete(key)
+	}
+	if c.store == nil {
+		return
+	}
+	c.removing = true
+	c.store.Remove(key)
+	c.removing = false
+}
+
+// 删除所有match返回true的缓存，包括磁盘上的，返回删除的条数
+func (c *cache) removeFunc(match func(key string) bool) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.changeAllLocked() //正在加载的key可能也在其中
+	n := 0
+	if c.disk != nil {
+		n += c.disk.DeleteFunc(match)
+	}
+	if c.store == nil {
+		return n
+	}
+	var keys []string
+	c.store.Walk(func(key string, _ lru.Value, _ time.Time) {
+		if match(key) {
+			keys = append(keys, key)
+		}
+	})
+	c.removing = true
+	for _, key := range keys {
+		c.store.Remove(key)
+	}
+	c.removing = false
+	return n + len(keys)
 }
 
 func (c *cache) get(key string) (value ByteView, ok bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	if c.lru == nil {
+	c.nget++
+	if c.store == nil {
 		return
 	}
 
-	if v, ok := c.lru.Get(key); ok {
+	if v, ok := c.store.Get(key); ok {
+		c.nhit++
 		return v.(ByteView), ok
 	}
+	if c.disk == nil {
+		return
+	}
+	if b, e, v, ok := c.disk.Get(key); ok { //磁盘命中，提升回内存，版本不变
+		c.nhit++
+		value = ByteView{b: b, e: e, v: v}
+		c.addLocked(key, value) //会把磁盘上的这条删除
+		return value, true
+	}
+
+	return
+}
 
+// 查看缓存值，不算一次访问，不影响淘汰顺序和命中统计，也不从磁盘提升回内存
+func (c *cache) peek(key string) (value ByteView, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.store != nil {
+		if v, _, ok := c.store.Peek(key); ok {
+			return v.(ByteView), true
+		}
+	}
+	if c.disk != nil {
+		if b, e, v, ok := c.disk.Get(key); ok {
+			return ByteView{b: b, e: e, v: v}, true
+		}
+	}
 	return
 }
+
+func (c *cache) stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := CacheStats{Gets: c.nget, Hits: c.nhit, Evictions: c.nevict}
+	if c.store != nil {
+		s.Bytes = c.store.Bytes()
+		s.Items = int64(c.store.Len())
+	}
+	return s
+}
+
+// 删除已经过期的缓存，返回删除的条数
+func (c *cache) removeExpired() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.store == nil {
+		return 0
+	}
+	return c.store.RemoveExpired()
+}
+
+// 按淘汰顺序遍历缓存。先在锁内拷贝出来，fn在锁外执行，不会长时间阻塞读写
+func (c *cache) walk(fn func(key string, value ByteView)) {
+	type item struct {
+		key   string
+		value ByteView
+	}
+	var items []item
+	c.mu.Lock()
+	if c.store != nil {
+		items = make([]item, 0, c.store.Len())
+		c.store.Walk(func(key string, value lru.Value, _ time.Time) {
+			items = append(items, item{key, value.(ByteView)})
+		})
+	}
+	c.mu.Unlock()
+	for _, it := range items {
+		fn(it.key, it.value)
+	}
+}
@@ -1,9 +1,25 @@
 package geecache
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"geecache/wire"
+	"io"
+	"io/ioutil"
 	"log"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 var db = map[string]string{
@@ -40,3 +56,800 @@ func TestGet(t *testing.T) {
 		t.Fatalf("the value of unknow should be empty, but %s got", view)
 	}
 }
+
+func TestGetTTL(t *testing.T) {
+	loads := 0
+	gee := NewGroup("ttl", 2<<10, GetterWithTTLFunc(
+		func(key string) ([]byte, time.Duration, error) {
+			loads++
+			if key == "short" {
+				return []byte("1"), 20 * time.Millisecond, nil
+			}
+			return []byte("2"), 0, nil // falls back to the group TTL
+		}), WithTTL(time.Hour))
+
+	view, err := gee.Get("short")
+	if err != nil || view.Expire().IsZero() {
+		t.Fatalf("short should carry an expire time, got %v %v", view.Expire(), err)
+	}
+	if view, _ := gee.Get("long"); time.Until(view.Expire()) < 59*time.Minute {
+		t.Fatalf("long should use the group TTL, expires at %v", view.Expire())
+	}
+	gee.Get("short")
+	if loads != 2 {
+		t.Fatalf("short should be cached before it expires, loads=%d", loads)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	gee.Get("short")
+	if loads != 3 {
+		t.Fatalf("expired short should be reloaded, loads=%d", loads)
+	}
+}
+
+func TestPeerTTL(t *testing.T) {
+	NewGroup("peerttl", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), WithTTL(time.Minute))
+	srv := httptest.NewServer(NewHTTPPool("owner"))
+	defer srv.Close()
+
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	view, err := getter.Get("peerttl", "Tom")
+	if err != nil || view.String() != "Tom" {
+		t.Fatalf("failed to get Tom from peer: %v", err)
+	}
+	if ttl := time.Until(view.Expire()); ttl <= 0 || ttl > time.Minute {
+		t.Fatalf("peer TTL not honoured, %v left", ttl)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	var loads int32
+	started, release := make(chan struct{}), make(chan struct{})
+	gee := NewGroup("remove", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if atomic.AddInt32(&loads, 1) == 1 {
+				close(started)
+				<-release // the first load is still in flight when Remove runs
+			}
+			return []byte(fmt.Sprintf("v%d", atomic.LoadInt32(&loads))), nil
+		}))
+
+	done := make(chan ByteView)
+	go func() {
+		view, _ := gee.Get("Tom")
+		done <- view
+	}()
+	<-started
+	if err := gee.Remove("Tom"); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	<-done
+
+	if view, err := gee.Get("Tom"); err != nil || view.String() != "v2" {
+		t.Fatalf("in-flight load was resurrected after Remove, got %s", view)
+	}
+	if view, _ := gee.Get("Tom"); view.String() != "v2" || atomic.LoadInt32(&loads) != 2 {
+		t.Fatalf("Tom should be cached again, loads=%d", loads)
+	}
+}
+
+func TestRemoveOtherKey(t *testing.T) {
+	var loads int32
+	started, release := make(chan struct{}), make(chan struct{})
+	gee, _ := NewCache().NewGroup("scores", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if key == "Tom" && atomic.AddInt32(&loads, 1) == 1 {
+				close(started)
+				<-release // Tom的加载还没有完成时删除了Jack
+			}
+			return []byte(key), nil
+		}))
+
+	done := make(chan struct{})
+	go func() {
+		gee.Get("Tom")
+		close(done)
+	}()
+	<-started
+	gee.Remove("Jack")
+	close(release)
+	<-done
+
+	if _, ok := gee.mainCache.get("Tom"); !ok {
+		t.Fatalf("removing Jack should not drop the in-flight load of Tom")
+	}
+}
+
+func TestPeerRemove(t *testing.T) {
+	loads := 0
+	gee := NewGroup("peerremove", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return []byte(key), nil
+		}))
+	srv := httptest.NewServer(NewHTTPPool("owner"))
+	defer srv.Close()
+
+	gee.Get("Tom")
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	if err := getter.Remove("peerremove", "Tom"); err != nil {
+		t.Fatal(err)
+	}
+	gee.Get("Tom")
+	if loads != 2 {
+		t.Fatalf("Tom should be reloaded after a peer Remove, loads=%d", loads)
+	}
+}
+
+type fakePeer struct {
+	gets int
+}
+
+func (p *fakePeer) Get(group string, key string) (ByteView, error) {
+	p.gets++
+	return ByteView{b: []byte(key)}, nil
+}
+
+func (p *fakePeer) GetContext(ctx context.Context, group string, key string) (ByteView, error) {
+	return p.Get(group, key)
+}
+
+func (p *fakePeer) Remove(group string, key string) error { return nil }
+
+func (p *fakePeer) PickPeer(key string) (PeerGetter, bool) { return p, true }
+
+func TestHotCache(t *testing.T) {
+	gee := NewGroup("hot", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			t.Fatalf("%s should be loaded from the peer", key)
+			return nil, nil
+		}))
+	peer := &fakePeer{}
+	gee.RegisterPeers(peer)
+
+	for peer.gets < 200 && gee.CacheStats(HotCache).Items == 0 {
+		if view, err := gee.Get("Tom"); err != nil || view.String() != "Tom" {
+			t.Fatalf("failed to get Tom from peer: %v", err)
+		}
+	} // sooner or later the hot key is kept locally
+
+	n := peer.gets
+	gee.Get("Tom")
+	if peer.gets != n {
+		t.Fatalf("Tom should be served from the hot cache")
+	}
+	if s := gee.CacheStats(HotCache); s.Hits != 1 || s.Items != 1 {
+		t.Fatalf("unexpected hot cache stats %+v", s)
+	}
+	if s := gee.CacheStats(MainCache); s.Hits != 0 || s.Items != 0 {
+		t.Fatalf("unexpected main cache stats %+v", s)
+	}
+}
+
+func TestStats(t *testing.T) {
+	gee := NewGroup("stats", 16, GetterFunc(
+		func(key string) ([]byte, error) {
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%s not exist", key)
+		}))
+	gee.Get("Tom")
+	gee.Get("Tom")
+	gee.Get("Jack")
+	gee.Get("Sam") // the main cache gets 14 of the 16 bytes, so Tom is evicted
+	gee.Get("unknown")
+
+	s := &gee.Stats
+	if s.Gets.Get() != 5 || s.CacheHits.Get() != 1 || s.Loads.Get() != 4 ||
+		s.LocalLoads.Get() != 3 || s.LocalLoadErrs.Get() != 1 {
+		t.Fatalf("unexpected group stats gets=%v hits=%v loads=%v local=%v errs=%v",
+			&s.Gets, &s.CacheHits, &s.Loads, &s.LocalLoads, &s.LocalLoadErrs)
+	}
+	if cs := gee.CacheStats(MainCache); cs.Evictions != 1 || cs.Items != 2 {
+		t.Fatalf("unexpected main cache stats %+v", cs)
+	}
+
+	srv := httptest.NewServer(NewHTTPPool("self"))
+	defer srv.Close()
+	res, err := http.Get(srv.URL + defaultBasePath + statsPath + "?group=stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var got map[string]struct {
+		Stats     map[string]int64
+		MainCache CacheStats
+	}
+	if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got["stats"].Stats["Gets"] != 5 || got["stats"].MainCache.Evictions != 1 {
+		t.Fatalf("unexpected stats over HTTP %+v", got)
+	}
+}
+
+func TestShardedCache(t *testing.T) {
+	c := newShardedCache(4, 4<<10, LRUPolicy)
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i)
+		c.add(key, ByteView{b: []byte(key)})
+	}
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i)
+		if v, ok := c.get(key); !ok || v.String() != key {
+			t.Fatalf("cache hit %s failed", key)
+		}
+	}
+	for _, shard := range c.shards {
+		if shard.cacheBytes != 1<<10 || shard.stats().Items == 0 {
+			t.Fatalf("keys should spread over shards with 1KB each, got %+v", shard.stats())
+		}
+	}
+	if s := c.stats(); s.Items != 100 || s.Hits != 100 {
+		t.Fatalf("unexpected sharded cache stats %+v", s)
+	}
+}
+
+// go test -run xxx -bench CacheParallel -cpu 1,2,4,8
+func BenchmarkCacheParallel(b *testing.B) {
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+	for _, n := range []int{1, 16} {
+		b.Run(fmt.Sprintf("shards=%d", n), func(b *testing.B) {
+			c := newShardedCache(n, 0, LRUPolicy)
+			for _, key := range keys {
+				c.add(key, ByteView{b: []byte(key)})
+			}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for i := rand.Intn(len(keys)); pb.Next(); i++ {
+					key := keys[i%len(keys)]
+					if i%10 == 0 {
+						c.add(key, ByteView{b: []byte(key)})
+					} else {
+						c.get(key)
+					}
+				}
+			})
+		})
+	}
+}
+
+func TestGetContext(t *testing.T) {
+	release, shared := make(chan struct{}), make(chan struct{})
+	gee := NewGroup("context", 2<<10, GetterContextFunc(
+		func(ctx context.Context, key string) ([]byte, error) {
+			if key == "slow" {
+				<-release
+				return []byte("slow"), nil
+			}
+			if key == "shared" {
+				<-shared
+				return []byte("shared"), ctx.Err()
+			}
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := gee.GetContext(ctx, "Tom"); err != context.DeadlineExceeded {
+		t.Fatalf("Getter should see the deadline, got %v", err)
+	}
+
+	done := make(chan ByteView)
+	go func() {
+		view, _ := gee.Get("slow")
+		done <- view
+	}()
+	time.Sleep(10 * time.Millisecond)
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err := gee.GetContext(ctx, "slow"); err != context.Canceled {
+		t.Fatalf("a cancelled waiter should stop waiting, got %v", err)
+	}
+	close(release)
+	if view := <-done; view.String() != "slow" {
+		t.Fatalf("the first caller should still get its value, got %s", view)
+	}
+
+	// 第一个请求取消之后，其他还在等待的请求依然拿到加载的结果
+	first, second := make(chan error), make(chan ByteView)
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		_, err := gee.GetContext(ctx, "shared")
+		first <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	go func() {
+		view, _ := gee.Get("shared")
+		second <- view
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	if err := <-first; err != context.Canceled {
+		t.Fatalf("the first caller should stop waiting, got %v", err)
+	}
+	close(shared)
+	if view := <-second; view.String() != "shared" {
+		t.Fatalf("a waiter should not get the cancellation of the first caller, got %q", view)
+	}
+
+	srv := httptest.NewServer(NewHTTPPool("owner"))
+	defer srv.Close()
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	if _, err := getter.GetContext(ctx, "context", "slow"); err == nil {
+		t.Fatalf("a cancelled peer request should fail")
+	}
+}
+
+func TestContentNegotiation(t *testing.T) {
+	NewGroup("negotiation", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if key == "unknown" {
+				return nil, fmt.Errorf("%s not exist", key)
+			}
+			return []byte(key), nil
+		}), WithTTL(time.Minute))
+	srv := httptest.NewServer(NewHTTPPool("owner"))
+	defer srv.Close()
+
+	// an old peer does not ask for frames and gets raw bytes
+	res, err := http.Get(srv.URL + defaultBasePath + "negotiation/Tom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if res.Header.Get("Content-Type") != "application/octet-stream" || string(body) != "Tom" || res.Header.Get(ttlHeader) == "" {
+		t.Fatalf("old peers should get raw bytes, got %s %q", res.Header.Get("Content-Type"), body)
+	}
+
+	// a new peer asks for frames and gets the error inside one
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	if _, err := getter.Get("negotiation", "unknown"); err == nil || !strings.Contains(err.Error(), "unknown not exist") {
+		t.Fatalf("the load error should be carried in the frame, got %v", err)
+	}
+
+	req := wire.Request{Group: "negotiation", Key: "Jack"}
+	data, _ := req.MarshalBinary()
+	res, err = http.Post(srv.URL+defaultBasePath, wire.ContentType, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	var out wire.Response
+	if err := out.UnmarshalBinary(body); err != nil || string(out.Value) != "Jack" || out.TTL <= 0 {
+		t.Fatalf("unexpected frame response %+v %v", out, err)
+	}
+}
+
+type batchPeer struct {
+	fakePeer
+	batches [][]string
+}
+
+func (p *batchPeer) GetMany(ctx context.Context, group string, keys []string) ([]Result, error) {
+	p.batches = append(p.batches, keys)
+	results := make([]Result, len(keys))
+	for i, key := range keys {
+		results[i] = Result{Key: key, Value: ByteView{b: []byte("peer " + key)}}
+	}
+	return results, nil
+}
+
+// 以p开头的key由远程节点负责
+func (p *batchPeer) PickPeer(key string) (PeerGetter, bool) { return p, strings.HasPrefix(key, "p") }
+
+func TestGetMany(t *testing.T) {
+	var batches [][]string
+	gee := NewGroup("many", 2<<10, batchGetter(func(ctx context.Context, keys []string) ([][]byte, []error) {
+		batches = append(batches, keys)
+		values, errs := make([][]byte, len(keys)), make([]error, len(keys))
+		for i, key := range keys {
+			if v, ok := db[key]; ok {
+				values[i] = []byte(v)
+			} else {
+				errs[i] = fmt.Errorf("%s not exist", key)
+			}
+		}
+		return values, errs
+	}))
+	peer := &batchPeer{}
+	gee.RegisterPeers(peer)
+	gee.Get("Tom") // cached before the batch
+
+	results := gee.GetMany([]string{"Tom", "Jack", "p1", "unknown", "p2", ""})
+	expect := []string{"630", "589", "peer p1", "", "peer p2", ""}
+	for i, r := range results {
+		if r.Value.String() != expect[i] || (r.Err != nil) != (expect[i] == "") {
+			t.Fatalf("result %d: expect %q, got %q %v", i, expect[i], r.Value, r.Err)
+		}
+	}
+	if len(batches) != 2 || len(batches[1]) != 2 || len(peer.batches) != 1 || len(peer.batches[0]) != 2 {
+		t.Fatalf("expect one batch per owner, got local %v peer %v", batches, peer.batches)
+	}
+	if v, ok := gee.mainCache.get("Jack"); !ok || v.String() != "589" {
+		t.Fatalf("Jack should be cached after the batch load")
+	}
+}
+
+type batchGetter func(ctx context.Context, keys []string) ([][]byte, []error)
+
+func (f batchGetter) Get(key string) ([]byte, error) {
+	values, errs := f(context.Background(), []string{key})
+	return values[0], errs[0]
+}
+
+func (f batchGetter) GetMany(ctx context.Context, keys []string) ([][]byte, []error) {
+	return f(ctx, keys)
+}
+
+func TestPeerGetMany(t *testing.T) {
+	NewGroup("peermany", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%s not exist", key)
+		}), WithTTL(time.Minute))
+	srv := httptest.NewServer(NewHTTPPool("owner"))
+	defer srv.Close()
+
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	results, err := getter.GetMany(context.Background(), "peermany", []string{"Tom", "unknown", "Sam"})
+	if err != nil || len(results) != 3 {
+		t.Fatalf("failed to get many from peer: %v", err)
+	}
+	if results[0].Value.String() != "630" || results[0].Value.Expire().IsZero() ||
+		results[1].Err == nil || results[2].Value.String() != "567" {
+		t.Fatalf("unexpected results %+v", results)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	loads := 0
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		if v, ok := db[key]; ok {
+			return []byte(v), nil
+		}
+		return nil, fmt.Errorf("%s not exist", key)
+	})
+	path := t.TempDir() + "/scores.snap"
+	gee, _ := NewCache().NewGroup("scores", 2<<10, getter, WithSnapshot(path, 0))
+	for _, key := range []string{"Tom", "Jack", "Sam", "Tom"} { //Tom最近被访问过
+		gee.Get(key)
+	}
+	gee.mainCache.add("old", ByteView{b: []byte("1"), e: time.Now().Add(-time.Second)})
+	if err := gee.snapshotFile(); err != nil {
+		t.Fatalf("failed to snapshot: %v", err)
+	}
+
+	// 新的分组只能放下两条缓存，恢复之后留下最近访问的Sam和Tom
+	loads = 0
+	small, _ := NewCache().NewGroup("scores", 13, getter, WithSnapshot(path, 0))
+	if s := small.CacheStats(MainCache); s.Items != 2 {
+		t.Fatalf("expect 2 values restored, got %d", s.Items)
+	}
+	for _, key := range []string{"Tom", "Sam"} {
+		old, _ := gee.mainCache.peek(key)
+		if v, err := small.Get(key); err != nil || v.String() != db[key] {
+			t.Fatalf("failed to get restored %s", key)
+		} else if v.Version() != old.Version() {
+			t.Fatalf("restored %s should keep version %d, got %d", key, old.Version(), v.Version())
+		}
+	}
+	if loads != 0 {
+		t.Fatalf("restored values should not be loaded again, got %d loads", loads)
+	}
+
+	var buf bytes.Buffer
+	gee.Snapshot(&buf)
+	truncated, _ := NewCache().NewGroup("scores", 2<<10, getter)
+	err := truncated.Restore(bytes.NewReader(buf.Bytes()[:buf.Len()-2]))
+	if err != io.ErrUnexpectedEOF {
+		t.Fatalf("expect io.ErrUnexpectedEOF from a truncated snapshot, got %v", err)
+	}
+
+	// 损坏的长度字段不能导致按它分配内存
+	corrupt := append([]byte(snapshotMagic), snapshotVersion, 1, 'k')
+	corrupt = binary.AppendUvarint(corrupt, 1<<40)
+	if err := truncated.Restore(bytes.NewReader(corrupt)); err == nil {
+		t.Fatalf("expect an error from a corrupt length")
+	}
+	corrupt = binary.AppendUvarint(append([]byte(snapshotMagic), snapshotVersion, 1, 'k'), 1<<30)
+	if err := truncated.Restore(bytes.NewReader(corrupt)); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expect io.ErrUnexpectedEOF from a length past the end, got %v", err)
+	}
+}
+
+func TestDiskTier(t *testing.T) {
+	loads := 0
+	gee, err := NewCache().NewGroup("scores", 15, GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		return []byte(db[key]), nil
+	}), WithDiskTier(t.TempDir(), 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 内存只能放下两条，Tom被淘汰到磁盘
+	tom, _ := gee.Get("Tom")
+	for _, key := range []string{"Jack", "Sam"} {
+		gee.Get(key)
+	}
+	if s := gee.CacheStats(MainCache); s.Items != 2 || s.Evictions != 1 {
+		t.Fatalf("expect Tom evicted from memory, got %+v", s)
+	}
+	if v, err := gee.Get("Tom"); err != nil || v.String() != "630" || loads != 3 {
+		t.Fatalf("Tom should be promoted from disk without loading, %d loads", loads)
+	} else if v.Version() != tom.Version() {
+		t.Fatalf("Tom should keep its version %d on disk, got %d", tom.Version(), v.Version())
+	}
+
+	// Tom回到内存时把Jack挤到了磁盘上，删除之后磁盘上也没有了
+	if _, _, _, ok := gee.mainCache.shards[0].disk.Get("Jack"); !ok {
+		t.Fatalf("Jack should be demoted to disk")
+	}
+	gee.Remove("Jack")
+	if _, err := gee.Get("Jack"); err != nil || loads != 4 {
+		t.Fatalf("removed Jack should be loaded again, %d loads", loads)
+	}
+}
+
+func TestNegativeCache(t *testing.T) {
+	loads := 0
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		if v, ok := db[key]; ok {
+			return []byte(v), nil
+		}
+		return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+	})
+	c := NewCache()
+	gee, _ := c.NewGroup("scores", 2<<10, getter, WithNegativeTTL(50*time.Millisecond))
+	for i := 0; i < 3; i++ {
+		if _, err := gee.Get("unknown"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expect ErrNotFound, got %v", err)
+		}
+	}
+	if loads != 1 || gee.Stats.NegativeHits.Get() != 2 {
+		t.Fatalf("unknown should be loaded once, got %d loads", loads)
+	}
+	time.Sleep(60 * time.Millisecond)
+	gee.Get("unknown")
+	if loads != 2 {
+		t.Fatalf("unknown should be loaded again after the negative ttl")
+	}
+
+	// 远程节点返回的ErrNotFound不需要本地再加载
+	srv := httptest.NewServer(c.NewHTTPPool("owner"))
+	defer srv.Close()
+	getter2 := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	if _, err := getter2.Get("scores", "missing"); !errors.Is(err, ErrNotFound) || err.Error() != "missing: geecache: not found" {
+		t.Fatalf("expect ErrNotFound with the original message from the peer, got %v", err)
+	}
+}
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	var loads int32
+	gee, _ := NewCache().NewGroup("scores", 2<<10, GetterWithTTLFunc(func(key string) ([]byte, time.Duration, error) {
+		n := atomic.AddInt32(&loads, 1)
+		if n == 1 { //第一次加载的值很快过期
+			return []byte("1"), 20 * time.Millisecond, nil
+		}
+		return []byte(strconv.Itoa(int(n))), time.Hour, nil
+	}), WithStaleWhileRevalidate(time.Minute))
+
+	gee.Get("Tom")
+	time.Sleep(30 * time.Millisecond)
+	for i := 0; i < 5; i++ { //过期之后立刻返回旧值，只发起一次后台刷新
+		if v, err := gee.Get("Tom"); err != nil || v.String() != "1" {
+			t.Fatalf("expect the stale value 1, got %v %v", v, err)
+		}
+	}
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if v, _ := gee.mainCache.get("Tom"); v.String() == "2" {
+			break
+		}
+	}
+	if v, _ := gee.Get("Tom"); v.String() != "2" || atomic.LoadInt32(&loads) != 2 {
+		t.Fatalf("expect one refresh to 2, got %s after %d loads", v, atomic.LoadInt32(&loads))
+	}
+}
+
+func TestSetWriteThrough(t *testing.T) {
+	loads := 0
+	store := map[string]string{}
+	fail := false
+	setter := SetterFunc(func(ctx context.Context, key string, value []byte) error {
+		if fail {
+			return errors.New("db down")
+		}
+		store[key] = string(value)
+		return nil
+	})
+	c := NewCache()
+	gee, _ := c.NewGroup("scores", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		return []byte(db[key]), nil
+	}), WithWriteThrough(setter))
+	gee.Get("Tom")
+	if err := gee.Set("Tom", []byte("700")); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := gee.Get("Tom"); v.String() != "700" || store["Tom"] != "700" || loads != 1 {
+		t.Fatalf("Tom should be written to both the cache and the setter, got %s/%s", v, store["Tom"])
+	}
+	fail = true
+	if err := gee.Set("Tom", []byte("800")); err == nil {
+		t.Fatal("expect error when the setter fails")
+	}
+	if v, _ := gee.Get("Tom"); v.String() != "700" {
+		t.Fatalf("a failed write must not be cached, got %s", v)
+	}
+
+	// 远程节点写入的值，只有不是副本时才写数据源
+	srv := httptest.NewServer(c.NewHTTPPool("owner"))
+	defer srv.Close()
+	fail = false
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	if _, err := getter.Set(context.Background(), "scores", "Sam", []byte("1"), 42); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := gee.Get("Sam"); v.String() != "1" || v.Version() != 42 || store["Sam"] != "" {
+		t.Fatalf("a replica write should only be cached with the given version, got %s/%s", v, store["Sam"])
+	}
+	if _, err := getter.Set(context.Background(), "scores", "Sam", []byte("2"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := gee.Get("Sam"); v.String() != "2" || store["Sam"] != "2" {
+		t.Fatalf("Sam should be persisted by the owner, got %s/%s", v, store["Sam"])
+	}
+}
+
+type batchStore struct {
+	mu      sync.Mutex
+	batches int
+	values  map[string]string
+}
+
+func (s *batchStore) Set(ctx context.Context, key string, value []byte) error {
+	return s.SetMany(ctx, []string{key}, [][]byte{value})
+}
+
+func (s *batchStore) SetMany(ctx context.Context, keys []string, values [][]byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches++
+	for i, key := range keys {
+		s.values[key] = string(values[i])
+	}
+	return nil
+}
+
+func TestWriteBehind(t *testing.T) {
+	store := &batchStore{values: map[string]string{}}
+	gee, _ := NewCache().NewGroup("scores", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(db[key]), nil
+	}), WithWriteBehind(store, time.Hour, 3))
+	gee.Set("Tom", []byte("1"))
+	gee.Set("Tom", []byte("2"))
+	gee.Set("Jack", []byte("3"))
+	if v, _ := gee.Get("Tom"); v.String() != "2" {
+		t.Fatalf("Tom should be cached at once, got %s", v)
+	}
+	store.mu.Lock()
+	batches := store.batches
+	store.mu.Unlock()
+	if batches != 0 {
+		t.Fatal("nothing should be persisted before the batch is full")
+	}
+	if err := gee.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if store.batches != 1 || store.values["Tom"] != "2" || store.values["Jack"] != "3" {
+		t.Fatalf("expect one batch with the last values, got %d batches %v", store.batches, store.values)
+	}
+	if _, err := NewCache().NewGroup("zero", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return nil, nil
+	}), WithWriteBehind(store, 0, 0)); err != nil { //间隔为0时使用默认值，后台协程不能panic
+		t.Fatal(err)
+	}
+
+	// 待写入的key达到maxBatch时立刻写入
+	gee.Set("a", []byte("a"))
+	gee.Set("b", []byte("b"))
+	gee.Set("c", []byte("c"))
+	for i := 0; i < 100; i++ {
+		store.mu.Lock()
+		batches = store.batches
+		store.mu.Unlock()
+		if batches == 2 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("a full batch should be persisted without waiting for the interval")
+}
+
+func TestCompareAndSet(t *testing.T) {
+	c := NewCache()
+	gee, _ := c.NewGroup("scores", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		if v, ok := db[key]; ok {
+			return []byte(v), nil
+		}
+		return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+	}))
+	v, _ := gee.Get("Tom")
+	version, err := gee.CompareAndSet("Tom", v.Version(), []byte("631"))
+	if err != nil || version <= v.Version() {
+		t.Fatalf("expect a newer version than %d, got %d %v", v.Version(), version, err)
+	}
+	if _, err := gee.CompareAndSet("Tom", v.Version(), []byte("632")); !errors.Is(err, ErrVersionMismatch) {
+		t.Fatalf("expect ErrVersionMismatch with an old version, got %v", err)
+	}
+	if v, _ := gee.Get("Tom"); v.String() != "631" || v.Version() != version {
+		t.Fatalf("expect 631 with version %d, got %s with version %d", version, v, v.Version())
+	}
+	// 版本0代表数据源中没有该key
+	if _, err := gee.CompareAndSet("Bob", 0, []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gee.CompareAndSet("Bob", 0, []byte("2")); !errors.Is(err, ErrVersionMismatch) {
+		t.Fatalf("Bob exists now, expect ErrVersionMismatch, got %v", err)
+	}
+
+	// 通过远程节点比较写入，版本随响应一起返回
+	srv := httptest.NewServer(c.NewHTTPPool("owner"))
+	defer srv.Close()
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	v, err = getter.Get("scores", "Tom")
+	if err != nil || v.Version() != version {
+		t.Fatalf("expect version %d from the peer, got %d %v", version, v.Version(), err)
+	}
+	if _, err := getter.CompareAndSet(context.Background(), "scores", "Tom", version-1, []byte("0")); !errors.Is(err, ErrVersionMismatch) {
+		t.Fatalf("expect ErrVersionMismatch from the peer, got %v", err)
+	}
+	next, err := getter.CompareAndSet(context.Background(), "scores", "Tom", version, []byte("700"))
+	if err != nil || next <= version {
+		t.Fatalf("expect a newer version from the peer, got %d %v", next, err)
+	}
+	if v, _ := gee.Get("Tom"); v.String() != "700" {
+		t.Fatalf("expect 700, got %s", v)
+	}
+}
+
+func TestSlowLoadKeepsNewerValue(t *testing.T) {
+	release := make(chan struct{})
+	loads := int32(0)
+	gee, _ := NewCache().NewGroup("scores", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		if atomic.AddInt32(&loads, 1) == 1 { //第一次加载很慢
+			<-release
+			return []byte("old"), nil
+		}
+		return []byte("new"), nil
+	}))
+	done := make(chan struct{})
+	go func() {
+		gee.getLocally(context.Background(), "Tom")
+		close(done)
+	}()
+	for atomic.LoadInt32(&loads) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	gee.getLocally(context.Background(), "Tom")
+	close(release)
+	<-done
+	if v, _ := gee.Get("Tom"); v.String() != "new" {
+		t.Fatalf("a slow load must not overwrite a newer one, got %s", v)
+	}
+}
@@ -0,0 +1,97 @@
+/*
+ * @Description:有界负载的一致性hash（consistent hashing with bounded loads）
+ * 每个节点正在处理的请求数不能超过平均值的factor倍，超过时顺时针交给下一个节点，
+ * 少数热点key不会把负责它们的节点压垮
+ * @version:
+ * @Author: Steven
+ * @Date: 2023-04-25 20:40:18
+ */
+package consistenthash
+
+import (
+	"math"
+	"sync"
+)
+
+// Bounded is a Map that caps the in-flight load of every node at factor
+// times the average, scaled by the node's weight. A key whose owner is at
+// the cap goes to the next node clockwise that is below it. GetN is not
+// bounded.
+type Bounded struct {
+	*Map
+	factor float64
+
+	mu    sync.Mutex     // guards loads and total
+	loads map[string]int //每个节点正在处理的请求数
+	total int
+}
+
+// NewBounded creates a Bounded instance. factor must be greater than 1,
+// 1.25 is a good start; smaller values balance better but move more keys.
+func NewBounded(replicas int, factor float64, fn Hash) *Bounded {
+	if factor <= 1 {
+		factor = 1.25
+	}
+	return &Bounded{
+		Map:    New(replicas, fn),
+		factor: factor,
+		loads:  make(map[string]int),
+	}
+}
+
+// Get gets the closest node clockwise to the provided key whose load is
+// below the cap.
+func (b *Bounded) Get(key string) string {
+	return b.GetIf(key, func(string) bool { return true })
+}
+
+// GetIf is like Get, also skipping the nodes ok rejects.
+func (b *Bounded) GetIf(key string, ok func(node string) bool) string {
+	b.mu.Lock()
+	total := b.total
+	loads := make(map[string]int, len(b.loads)) //不能在回调里持有锁
+	for node, load := range b.loads {
+		loads[node] = load
+	}
+	b.mu.Unlock()
+	return b.Map.GetIf(key, func(node string) bool {
+		return loads[node] < b.limit(node, total) && ok(node)
+	})
+}
+
+// 节点允许的最大负载：再加一个请求之后，按权重分到该节点的平均负载的factor倍，向上取整，至少为1
+func (b *Bounded) limit(node string, total int) int {
+	if b.weight == 0 {
+		return 0
+	}
+	return int(math.Ceil(b.factor * float64(total+1) * float64(b.nodes[node]) / float64(b.weight)))
+}
+
+// Inc records that a request to node started.
+func (b *Bounded) Inc(node string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.loads[node]++
+	b.total++
+}
+
+// Done records that a request to node ended.
+func (b *Bounded) Done(node string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.loads[node] == 0 {
+		return
+	}
+	b.loads[node]--
+	b.total--
+	if b.loads[node] == 0 {
+		delete(b.loads, node)
+	}
+}
+
+// Load returns the number of in-flight requests to node.
+func (b *Bounded) Load(node string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.loads[node]
+}
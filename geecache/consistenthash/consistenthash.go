@@ -15,15 +15,30 @@ type Map struct {
 	hash     Hash           //hash函数
 	replicas int            //一个实节点，有几个虚拟节点
 	keys     []int          // Hash环上的所有节点，实际上是不包括实节点的，都是实节点的虚拟节点对应的hash值
-	hashMap  map[int]string //虚拟节点到实节点的映射，虚拟节点的hash值是key，实节点是value
+	hashMap  map[int]vnode  //虚拟节点hash值到虚拟节点的映射，虚拟节点中记录着实节点
+	nodes    map[string]int //hash环上的实节点及其权重
+	weight   int            //所有实节点的权重之和
+	dropped  map[vnode]bool //重新计算maxProbes次依然冲突、没有放到hash环上的虚拟节点
 }
 
+// 一个虚拟节点：实节点的第i个虚拟节点，hash值冲突时重新计算了probe次
+type vnode struct {
+	node  string
+	i     int
+	probe int
+}
+
+// 虚拟节点hash值冲突时，最多重新计算几次，还冲突就放弃这个虚拟节点
+const maxProbes = 16
+
 // New creates a Map instance
 func New(replicas int, fn Hash) *Map {
 	m := &Map{
 		replicas: replicas,
 		hash:     fn,
-		hashMap:  make(map[int]string),
+		hashMap:  make(map[int]vnode),
+		nodes:    make(map[string]int),
+		dropped:  make(map[vnode]bool),
 	}
 	if m.hash == nil {
 		m.hash = crc32.ChecksumIEEE //默认采用crc32.ChecksumIEEE
@@ -33,20 +48,198 @@ func New(replicas int, fn Hash) *Map {
 
 // 生成一个hash环
 // keys:所有实节点
-// Add adds some keys to the hash.
+// Add adds some keys to the hash. Keys already in the hash are ignored
+// and keep their weight; use AddWeighted to change it.
 func (m *Map) Add(keys ...string) {
+	var vnodes []vnode
+	for _, key := range keys {
+		if _, ok := m.nodes[key]; ok { //重复的节点不再添加，否则虚拟节点会重复出现在hash环上
+			continue
+		}
+		m.nodes[key] = 1
+		m.weight++
+		for i := 0; i < m.replicas; i++ {
+			vnodes = append(vnodes, vnode{node: key, i: i})
+		}
+	}
+	m.insert(vnodes)
+}
+
+// AddWeighted adds a key with weight times the virtual nodes of Add, so
+// that it owns about weight times as many keys. A weight below 1 is 1.
+// A key already in the hash gets the new weight.
+func (m *Map) AddWeighted(key string, weight int) {
+	if weight < 1 {
+		weight = 1
+	}
+	old := m.nodes[key]
+	if old == weight {
+		return
+	}
+	m.nodes[key] = weight //已经存在的节点修改权重，只增减它自己的虚拟节点
+	m.weight += weight - old
+	if weight < old {
+		m.remove(func(v vnode) bool { return v.node == key && v.i >= m.replicas*weight })
+		return
+	}
+	var vnodes []vnode
+	for i := m.replicas * old; i < m.replicas*weight; i++ {
+		vnodes = append(vnodes, vnode{node: key, i: i})
+	}
+	m.insert(vnodes)
+}
+
+// 从hash环上删除实节点，只删除这些实节点的虚拟节点，其他节点负责的key不受影响
+// Remove removes some keys from the hash.
+func (m *Map) Remove(keys ...string) {
+	removed := make(map[string]bool)
 	for _, key := range keys {
-		for i := 0; i < m.replicas; i++ { //针对每一个实节点，遍历计算出该实节点的所有虚拟节点
-			//应用New函数实例化map结构体时，传入的hash函数
-			//这里我们采用数字编号加上实节点名称组成的字符串作为虚拟节点
-			//hash变量就是虚拟节点的hash值
-			hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
-			m.keys = append(m.keys, hash) //将每一个虚拟节点的hash值，放到hash环里
-			m.hashMap[hash] = key         //进行虚拟节点hash值到实节点名称的映射
+		if w, ok := m.nodes[key]; ok {
+			delete(m.nodes, key)
+			m.weight -= w
+			removed[key] = true
+		}
+	}
+	if len(removed) > 0 {
+		m.remove(func(v vnode) bool { return removed[v.node] })
+	}
+}
+
+// 增删节点时只计算受影响的虚拟节点，不重新生成整个hash环。
+// 虚拟节点的hash值被占用时，加上重试次数重新计算；两个虚拟节点争同一个hash值时，
+// 按实节点名称、再按编号，排在前面的留下，另一个继续重新计算。
+// 所以同一组实节点，无论按什么顺序添加、删除，生成的hash环都一样，
+// 和按实节点名称排序之后依次放入虚拟节点的结果相同。
+// 没有冲突的虚拟节点位置只和自己有关，增删节点时其他节点负责的key不受影响
+
+// 放入虚拟节点，新占用的hash值有序地合并到hash环里
+func (m *Map) insert(vnodes []vnode) {
+	var added []int
+	for _, v := range vnodes {
+		added = m.place(v, added)
+	}
+	if len(added) == 0 {
+		return
+	}
+	sort.Ints(added)
+	keys := make([]int, 0, len(m.keys)+len(added))
+	i, j := 0, 0
+	for i < len(m.keys) || j < len(added) {
+		if j == len(added) || (i < len(m.keys) && m.keys[i] < added[j]) {
+			keys = append(keys, m.keys[i])
+			i++
+		} else {
+			keys = append(keys, added[j])
+			j++
+		}
+	}
+	m.keys = keys
+}
+
+// 从v.probe开始为虚拟节点找一个hash值，把新占用的hash值追加到added里返回。
+// 占用者排在v后面时，v留下，占用者接着往后找
+func (m *Map) place(v vnode, added []int) []int {
+	for {
+		if v.probe > maxProbes {
+			v.probe = 0
+			m.dropped[v] = true
+			return added
+		}
+		hash := m.vnodeHash(v)
+		cur, taken := m.hashMap[hash]
+		if !taken {
+			m.hashMap[hash] = v
+			return append(added, hash)
+		}
+		if v.before(cur) {
+			m.hashMap[hash] = v
+			v = cur
+		}
+		v.probe++
+	}
+}
+
+// 删除match返回true的虚拟节点。它们让出的hash值可能是别的虚拟节点冲突之前的位置，
+// 所以冲突过的虚拟节点重新放一次，没有冲突过的不受影响
+func (m *Map) remove(match func(v vnode) bool) {
+	var retry []vnode
+	keys := m.keys[:0]
+	for _, hash := range m.keys {
+		v := m.hashMap[hash]
+		if match(v) || v.probe > 0 {
+			delete(m.hashMap, hash)
+			if !match(v) {
+				v.probe = 0
+				retry = append(retry, v)
+			}
+			continue
+		}
+		keys = append(keys, hash)
+	}
+	m.keys = keys
+	for v := range m.dropped {
+		delete(m.dropped, v)
+		if !match(v) {
+			retry = append(retry, v)
 		}
 	}
-	//我们现在的hash换m.keys是无序的，我们必须对其进行排序！
-	sort.Ints(m.keys) //升序排列
+	m.insert(retry)
+}
+
+// 虚拟节点的hash值：数字编号加上实节点名称组成的字符串，冲突时再加上重试次数
+func (m *Map) vnodeHash(v vnode) int {
+	name := strconv.Itoa(v.i) + v.node
+	if v.probe > 0 {
+		name += "#" + strconv.Itoa(v.probe)
+	}
+	return int(m.hash([]byte(name)))
+}
+
+// 两个虚拟节点争同一个hash值时，v是否优先
+func (v vnode) before(o vnode) bool {
+	if v.node != o.node {
+		return v.node < o.node
+	}
+	return v.i < o.i
+}
+
+// Nodes returns the keys in the hash, sorted.
+func (m *Map) Nodes() []string {
+	nodes := make([]string, 0, len(m.nodes))
+	for key := range m.nodes {
+		nodes = append(nodes, key)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+// A VirtualNode is a point on the ring and the key that owns it.
+type VirtualNode struct {
+	Hash int
+	Node string
+}
+
+// Ring returns the virtual nodes in ascending order of hash. The keys
+// hashing into (previous Hash, Hash] belong to Node.
+func (m *Map) Ring() []VirtualNode {
+	ring := make([]VirtualNode, len(m.keys))
+	for i, hash := range m.keys {
+		ring[i] = VirtualNode{Hash: hash, Node: m.hashMap[hash].node}
+	}
+	return ring
+}
+
+// Collisions returns how many virtual nodes are off the point they first
+// hash to because it was taken. Colliding virtual nodes are rehashed, so
+// every key still gets its share unless this is huge.
+func (m *Map) Collisions() int {
+	n := len(m.dropped)
+	for _, v := range m.hashMap {
+		if v.probe > 0 {
+			n++
+		}
+	}
+	return n
 }
 
 // 根据缓存key，获取实节点名称
@@ -73,5 +266,53 @@ func (m *Map) Get(key string) string {
 	//为什么不直接m.keys[idx]，就是因为idx有等于len(m.keys)的情况，这个时候会报越界的错误。
 	//因为我们定义了idx=len(m.keys)时，就等同于idx=0,直接一步取余操作即可！
 
-	return m.hashMap[m.keys[idx%len(m.keys)]] //再通过hash值，就可以获取到对应的实节点了
+	return m.hashMap[m.keys[idx%len(m.keys)]].node //再通过hash值，就可以获取到对应的实节点了
+}
+
+// GetIf gets the closest item in the hash to the provided key for which
+// ok returns true, walking the ring clockwise past the ones it rejects.
+// It returns "" if ok rejects every item.
+func (m *Map) GetIf(key string, ok func(node string) bool) string {
+	if len(m.keys) == 0 {
+		return ""
+	}
+	hash := int(m.hash([]byte(key)))
+	idx := sort.Search(len(m.keys), func(i int) bool {
+		return m.keys[i] >= hash
+	})
+	rejected := make(map[string]bool) //一个实节点有多个虚拟节点，被拒绝过的不用再问
+	for i := 0; i < len(m.keys); i++ {
+		node := m.hashMap[m.keys[(idx+i)%len(m.keys)]].node
+		if rejected[node] {
+			continue
+		}
+		if ok(node) {
+			return node
+		}
+		rejected[node] = true
+	}
+	return ""
+}
+
+// GetN gets up to n distinct items in the hash, starting from the closest
+// to the provided key and walking the ring clockwise. The first one is
+// the item Get returns. Fewer than n are returned if there aren't enough.
+func (m *Map) GetN(key string, n int) []string {
+	if len(m.keys) == 0 || n <= 0 {
+		return nil
+	}
+	hash := int(m.hash([]byte(key)))
+	idx := sort.Search(len(m.keys), func(i int) bool {
+		return m.keys[i] >= hash
+	})
+	nodes := make([]string, 0, n)
+	seen := make(map[string]bool) //相邻的虚拟节点可能属于同一个实节点，只取一次
+	for i := 0; i < len(m.keys) && len(nodes) < n; i++ {
+		node := m.hashMap[m.keys[(idx+i)%len(m.keys)]].node
+		if !seen[node] {
+			seen[node] = true
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
 }
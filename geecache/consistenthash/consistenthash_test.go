@@ -7,6 +7,9 @@
 package consistenthash
 
 import (
+	"hash/crc32"
+	"math"
+	"reflect"
 	"strconv"
 	"testing"
 )
@@ -57,3 +60,319 @@ func TestHashing(t *testing.T) {
 	}
 
 }
+
+func TestRemove(t *testing.T) {
+	hash := New(3, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+	hash.Add("6", "4", "2", "8")
+
+	hash.Remove("8") // 08, 18, 28 leave the ring
+	testCases := map[string]string{
+		"2":  "2",
+		"11": "2",
+		"23": "4",
+		"27": "2",
+	}
+	for k, v := range testCases {
+		if hash.Get(k) != v {
+			t.Errorf("Asking for %s, should have yielded %s", k, v)
+		}
+	}
+	if len(hash.keys) != 9 || len(hash.hashMap) != 9 {
+		t.Errorf("8 should leave no virtual nodes, got %v", hash.keys)
+	}
+}
+
+// 增加或者删除节点时，只有该节点负责的key会移动
+func TestMinimalMovement(t *testing.T) {
+	nodes := make([]string, 10)
+	for i := range nodes {
+		nodes[i] = "http://10.0.0." + strconv.Itoa(i) + ":8001"
+	}
+	keys := make([]string, 10000)
+	for i := range keys {
+		keys[i] = "key" + strconv.Itoa(i)
+	}
+	owners := func(m *Map) map[string]string {
+		o := make(map[string]string, len(keys))
+		for _, k := range keys {
+			o[k] = m.Get(k)
+		}
+		return o
+	}
+
+	hash := New(50, nil)
+	hash.Add(nodes...)
+	before := owners(hash)
+
+	hash.Add("http://10.0.0.10:8001")
+	moved := 0
+	for k, owner := range owners(hash) {
+		if owner != before[k] {
+			if owner != "http://10.0.0.10:8001" {
+				t.Fatalf("%s moved from %s to %s, not to the new node", k, before[k], owner)
+			}
+			moved++
+		}
+	}
+	if moved == 0 || moved > 2*len(keys)/11 {
+		t.Errorf("adding 1 of 11 nodes moved %d of %d keys", moved, len(keys))
+	}
+
+	hash.Remove("http://10.0.0.10:8001", nodes[3])
+	for k, owner := range owners(hash) {
+		if before[k] != nodes[3] && owner != before[k] {
+			t.Fatalf("%s moved from %s to %s, though its owner stayed", k, before[k], owner)
+		}
+		if owner == nodes[3] {
+			t.Fatalf("%s is still owned by the removed node", k)
+		}
+	}
+}
+
+func TestGetIf(t *testing.T) {
+	hash := New(3, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+	hash.Add("6", "4", "2")
+
+	// 2跳过之后，顺时针下一个是4
+	if node := hash.GetIf("11", func(node string) bool { return node != "2" }); node != "4" {
+		t.Errorf("expect 4 when 2 is skipped, got %s", node)
+	}
+	if node := hash.GetIf("11", func(string) bool { return true }); node != "2" {
+		t.Errorf("expect 2, got %s", node)
+	}
+	if node := hash.GetIf("11", func(string) bool { return false }); node != "" {
+		t.Errorf("expect no node when all are skipped, got %s", node)
+	}
+}
+
+func TestGetN(t *testing.T) {
+	hash := New(3, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+	hash.Add("6", "4", "2")
+
+	// key=11落在虚拟节点12上，顺时针依次是12、14、16，对应实节点2、4、6
+	testCases := []struct {
+		key    string
+		n      int
+		expect []string
+	}{
+		{"11", 1, []string{"2"}},
+		{"11", 2, []string{"2", "4"}},
+		{"27", 3, []string{"2", "4", "6"}},
+		{"27", 5, []string{"2", "4", "6"}},
+		{"27", 0, nil},
+	}
+	for _, tc := range testCases {
+		if nodes := hash.GetN(tc.key, tc.n); !reflect.DeepEqual(nodes, tc.expect) {
+			t.Errorf("GetN(%s, %d): expect %v, got %v", tc.key, tc.n, tc.expect, nodes)
+		}
+	}
+}
+
+// 10个节点、10000个key时，每个节点负责的key数
+func distribution(p Picker) (counts map[string]int, nodes []string) {
+	nodes = make([]string, 10)
+	for i := range nodes {
+		nodes[i] = "http://10.0.0." + strconv.Itoa(i) + ":8001"
+	}
+	p.Add(nodes...)
+	counts = make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		counts[p.Get("key"+strconv.Itoa(i))]++
+	}
+	return counts, nodes
+}
+
+func TestDistribution(t *testing.T) {
+	testCases := []struct {
+		name     string
+		picker   Picker
+		min, max int //每个节点负责的key数的范围，平均是1000
+	}{
+		{"ring", New(50, nil), 500, 1500},
+		{"jump", NewJump(nil), 850, 1150},
+		{"rendezvous", NewRendezvous(nil), 850, 1150},
+	}
+	for _, tc := range testCases {
+		counts, nodes := distribution(tc.picker)
+		for _, node := range nodes {
+			if counts[node] < tc.min || counts[node] > tc.max {
+				t.Errorf("%s: %s owns %d of 10000 keys, expect %d~%d", tc.name, node, counts[node], tc.min, tc.max)
+			}
+		}
+	}
+}
+
+func TestJumpAndRendezvousMovement(t *testing.T) {
+	for name, p := range map[string]Picker{"jump": NewJump(nil), "rendezvous": NewRendezvous(nil)} {
+		_, nodes := distribution(p)
+		before := make(map[string]string)
+		for i := 0; i < 10000; i++ {
+			key := "key" + strconv.Itoa(i)
+			before[key] = p.Get(key)
+		}
+
+		// 新节点只接管别的节点的一部分key
+		p.Add("http://10.0.0.10:8001")
+		moved := 0
+		for key, owner := range before {
+			if now := p.Get(key); now != owner {
+				if now != "http://10.0.0.10:8001" {
+					t.Fatalf("%s: %s moved from %s to %s, not to the new node", name, key, owner, now)
+				}
+				moved++
+			}
+		}
+		if moved < 10000/11/2 || moved > 2*10000/11 {
+			t.Errorf("%s: adding 1 of 11 nodes moved %d of 10000 keys", name, moved)
+		}
+
+		// 删除最后加入的节点之后，key回到原来的节点
+		p.Remove("http://10.0.0.10:8001")
+		for key, owner := range before {
+			if now := p.Get(key); now != owner {
+				t.Fatalf("%s: %s should move back to %s, got %s", name, key, owner, now)
+			}
+		}
+		if name != "rendezvous" { //跳跃一致性hash删除中间的节点时会重新编号
+			continue
+		}
+		p.Remove(nodes[3])
+		for key, owner := range before {
+			if now := p.Get(key); owner != nodes[3] && now != owner {
+				t.Fatalf("%s: %s moved from %s to %s, though its owner stayed", name, key, owner, now)
+			}
+		}
+	}
+}
+
+func TestBoundedLoad(t *testing.T) {
+	b := NewBounded(50, 1.25, nil)
+	_, nodes := distribution(b)
+
+	// 同一个热点key的请求都没有结束，负载超过上限之后交给下一个节点
+	for i := 0; i < 100; i++ {
+		b.Inc(b.Get("hot"))
+	}
+	limit := int(math.Ceil(1.25 * 100 / 10))
+	for _, node := range nodes {
+		if load := b.Load(node); load > limit {
+			t.Errorf("%s has %d in-flight requests, the limit is %d", node, load, limit)
+		}
+	}
+	if owner := b.Map.Get("hot"); b.Load(owner) != limit {
+		t.Errorf("the owner of hot should be filled up to %d first, got %d", limit, b.Load(owner))
+	}
+
+	// 请求结束之后，key回到原来的节点
+	for _, node := range nodes {
+		for b.Load(node) > 0 {
+			b.Done(node)
+		}
+	}
+	if b.Get("hot") != b.Map.Get("hot") {
+		t.Errorf("hot should go back to its owner once the load drops")
+	}
+}
+
+func TestAddWeighted(t *testing.T) {
+	hash := New(50, nil)
+	hash.Add("http://10.0.0.1:8001", "http://10.0.0.2:8001")
+	hash.AddWeighted("http://10.0.0.3:8001", 2)
+	counts := make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		counts[hash.Get("key"+strconv.Itoa(i))]++
+	}
+	// 权重为2的节点负责大约一半的key
+	if n := counts["http://10.0.0.3:8001"]; n < 4000 || n > 6000 {
+		t.Errorf("a node of weight 2 among 2 of weight 1 should own about 5000 of 10000 keys, got %d", n)
+	}
+
+	// 再次加入时修改权重，不会被忽略
+	hash.AddWeighted("http://10.0.0.3:8001", 1)
+	if len(hash.keys) != 150 || hash.weight != 3 {
+		t.Errorf("adding a node again should change its weight, got %d virtual nodes", len(hash.keys))
+	}
+
+	hash.Remove("http://10.0.0.3:8001")
+	if len(hash.keys) != 100 || len(hash.hashMap) != 100 {
+		t.Errorf("a weighted node should leave all its virtual nodes, %d are left", len(hash.keys))
+	}
+}
+
+func TestCollisions(t *testing.T) {
+	// 只有7个hash值，6个虚拟节点必然冲突
+	small := func(key []byte) uint32 {
+		return crc32.ChecksumIEEE(key) % 7
+	}
+	a := New(3, small)
+	a.Add("A", "B")
+	b := New(3, small)
+	b.Add("B")
+	b.Add("A")
+	b.Add("A") //重复的节点被忽略
+
+	if a.Collisions() == 0 {
+		t.Fatalf("expect collisions with only 7 hash values")
+	}
+	if !reflect.DeepEqual(a.Ring(), b.Ring()) {
+		t.Fatalf("the ring should not depend on the order of Add:\n%v\n%v", a.Ring(), b.Ring())
+	}
+	owned := make(map[string]int)
+	for _, vnode := range a.Ring() {
+		owned[vnode.Node]++
+	}
+	if owned["A"] != 3 || owned["B"] != 3 {
+		t.Fatalf("colliding virtual nodes should be rehashed, not dropped: %v", a.Ring())
+	}
+	if !reflect.DeepEqual(b.Nodes(), []string{"A", "B"}) {
+		t.Fatalf("expect nodes [A B], got %v", b.Nodes())
+	}
+
+	b.Remove("B")
+	if ring := b.Ring(); len(ring) != 3 || ring[0].Node != "A" || ring[1].Node != "A" || ring[2].Node != "A" {
+		t.Fatalf("only A's virtual nodes should be left, got %v", ring)
+	}
+	fresh := New(3, small)
+	fresh.Add("A")
+	if !reflect.DeepEqual(b.Ring(), fresh.Ring()) {
+		t.Fatalf("A's virtual nodes should go back to their own points:\n%v\n%v", b.Ring(), fresh.Ring())
+	}
+
+	// 增删节点、修改权重之后，hash环和直接生成的一样
+	b.Add("C", "B")
+	b.AddWeighted("C", 2)
+	b.Remove("A")
+	b.AddWeighted("C", 1)
+	fresh = New(3, small)
+	fresh.Add("B", "C")
+	if !reflect.DeepEqual(b.Ring(), fresh.Ring()) {
+		t.Fatalf("the ring should not depend on the history of changes:\n%v\n%v", b.Ring(), fresh.Ring())
+	}
+
+	// 只有新增的虚拟节点要计算hash值，已有的虚拟节点不重新计算
+	hashed := 0
+	counting := New(3, func(key []byte) uint32 {
+		hashed++
+		return crc32.ChecksumIEEE(key)
+	})
+	counting.Add("A", "B")
+	hashed = 0
+	counting.Add("C")
+	if hashed != 3 {
+		t.Fatalf("adding a node should hash only its 3 virtual nodes, hashed %d", hashed)
+	}
+	hashed = 0
+	counting.Remove("A")
+	if hashed != 0 {
+		t.Fatalf("removing a node should not rehash the ring, hashed %d", hashed)
+	}
+}
@@ -0,0 +1,107 @@
+/*
+ * @Description:跳跃一致性hash（jump consistent hash），不需要虚拟节点，几乎不占内存，分布也更均匀
+ * 缺点是节点只能编号，只有增删最后一个节点时，才只移动必要的key
+ * @version:
+ * @Author: Steven
+ * @Date: 2023-04-25 21:15:02
+ */
+package consistenthash
+
+import "hash/crc32"
+
+// Jump picks nodes with the jump consistent hash of Lamping and Veach.
+// Nodes are numbered in the order they were added. Adding a node moves
+// only the keys it takes over, but removing any node other than the last
+// renumbers the ones after it and moves their keys too.
+type Jump struct {
+	hash  Hash
+	nodes []string
+	index map[string]int //节点名称到编号的映射
+}
+
+// NewJump creates a Jump instance.
+func NewJump(fn Hash) *Jump {
+	j := &Jump{hash: fn, index: make(map[string]int)}
+	if j.hash == nil {
+		j.hash = crc32.ChecksumIEEE
+	}
+	return j
+}
+
+// Add adds some nodes to the end of the numbering.
+func (j *Jump) Add(nodes ...string) {
+	for _, node := range nodes {
+		if _, ok := j.index[node]; ok {
+			continue
+		}
+		j.index[node] = len(j.nodes)
+		j.nodes = append(j.nodes, node)
+	}
+}
+
+// Remove removes some nodes, renumbering the ones after them.
+func (j *Jump) Remove(nodes ...string) {
+	for _, node := range nodes {
+		delete(j.index, node)
+	}
+	kept := j.nodes[:0]
+	for _, node := range j.nodes {
+		if _, ok := j.index[node]; ok {
+			j.index[node] = len(kept)
+			kept = append(kept, node)
+		}
+	}
+	j.nodes = kept
+}
+
+// Get gets the node owning key.
+func (j *Jump) Get(key string) string {
+	if len(j.nodes) == 0 {
+		return ""
+	}
+	return j.nodes[j.bucket(key)]
+}
+
+// GetN gets up to n distinct nodes: the owner of key, then the ones
+// numbered after it.
+func (j *Jump) GetN(key string, n int) []string {
+	if len(j.nodes) == 0 || n <= 0 {
+		return nil
+	}
+	if n > len(j.nodes) {
+		n = len(j.nodes)
+	}
+	first := j.bucket(key)
+	nodes := make([]string, n)
+	for i := range nodes {
+		nodes[i] = j.nodes[(first+i)%len(j.nodes)]
+	}
+	return nodes
+}
+
+// GetIf gets the first node in the order of GetN that ok accepts, or ""
+// if ok rejects them all.
+func (j *Jump) GetIf(key string, ok func(node string) bool) string {
+	for _, node := range j.GetN(key, len(j.nodes)) {
+		if ok(node) {
+			return node
+		}
+	}
+	return ""
+}
+
+func (j *Jump) bucket(key string) int {
+	return jump(uint64(j.hash([]byte(key))), len(j.nodes))
+}
+
+// 跳跃一致性hash：key在0~buckets-1中的编号。
+// 节点数从n增加到n+1时，每个key有1/(n+1)的概率跳到新节点，其余的key不动
+func jump(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
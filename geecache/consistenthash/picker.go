@@ -0,0 +1,57 @@
+/*
+ * @Description:选择节点的几种算法：hash环（Map）、有界负载的hash环（Bounded）、跳跃一致性hash（Jump）、最高随机权重（Rendezvous）
+ * @version:
+ * @Author: Steven
+ * @Date: 2023-04-25 20:12:36
+ */
+package consistenthash
+
+// A Picker maps keys to the nodes owning them. Map, Bounded, Jump and
+// Rendezvous are Pickers. Like Map, Pickers are not safe for concurrent
+// use unless they say otherwise. Adding a node that is already there is
+// a no-op.
+type Picker interface {
+	Add(nodes ...string)
+	Remove(nodes ...string)
+	Get(key string) string
+	GetN(key string, n int) []string
+	GetIf(key string, ok func(node string) bool) string
+}
+
+// A LoadTracker is a Picker that balances keys by the number of in-flight
+// requests to each node, so it must be told when one starts and ends.
+// Inc and Done are safe for concurrent use.
+type LoadTracker interface {
+	Picker
+	Inc(node string)
+	Done(node string)
+}
+
+// A WeightedPicker is a Picker whose nodes can own more or fewer keys
+// than one another. Map and Bounded are WeightedPickers. AddWeighted
+// changes the weight of a node that is already there.
+type WeightedPicker interface {
+	Picker
+	AddWeighted(node string, weight int)
+}
+
+var (
+	_ WeightedPicker = (*Map)(nil)
+	_ WeightedPicker = (*Bounded)(nil)
+	_ Picker         = (*Map)(nil)
+	_ LoadTracker    = (*Bounded)(nil)
+	_ Picker         = (*Jump)(nil)
+	_ Picker         = (*Rendezvous)(nil)
+)
+
+// 将两个32位的hash值混合成一个64位的值，murmur3的fmix64
+// crc32是线性的，直接拼接再求crc32，不同节点之间的大小关系和key几乎无关
+func mix(a, b uint32) uint64 {
+	h := uint64(a)<<32 | uint64(b)
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
@@ -0,0 +1,95 @@
+/*
+ * @Description:最高随机权重hash（rendezvous hashing, HRW）
+ * 每个节点对key打分，分数最高的节点负责该key，删除节点时只有该节点的key移动
+ * @version:
+ * @Author: Steven
+ * @Date: 2023-04-25 21:47:55
+ */
+package consistenthash
+
+import (
+	"hash/crc32"
+	"sort"
+)
+
+// Rendezvous picks nodes with highest random weight hashing: every node
+// scores the key and the highest score wins. It needs no virtual nodes
+// and only the keys of a removed node move, at O(nodes) per lookup.
+type Rendezvous struct {
+	hash  Hash
+	nodes map[string]uint32 //节点名称到节点hash值的映射
+}
+
+// NewRendezvous creates a Rendezvous instance.
+func NewRendezvous(fn Hash) *Rendezvous {
+	r := &Rendezvous{hash: fn, nodes: make(map[string]uint32)}
+	if r.hash == nil {
+		r.hash = crc32.ChecksumIEEE
+	}
+	return r
+}
+
+// Add adds some nodes.
+func (r *Rendezvous) Add(nodes ...string) {
+	for _, node := range nodes {
+		r.nodes[node] = r.hash([]byte(node))
+	}
+}
+
+// Remove removes some nodes.
+func (r *Rendezvous) Remove(nodes ...string) {
+	for _, node := range nodes {
+		delete(r.nodes, node)
+	}
+}
+
+// Get gets the node with the highest score for key.
+func (r *Rendezvous) Get(key string) string {
+	h := r.hash([]byte(key))
+	var (
+		best  string
+		score uint64
+	)
+	for node, nh := range r.nodes {
+		//分数相同时取名称小的，保证每个节点选出的结果一样
+		if s := mix(nh, h); best == "" || s > score || (s == score && node < best) {
+			best, score = node, s
+		}
+	}
+	return best
+}
+
+// GetN gets up to n distinct nodes by descending score for key.
+func (r *Rendezvous) GetN(key string, n int) []string {
+	if n <= 0 || len(r.nodes) == 0 {
+		return nil
+	}
+	h := r.hash([]byte(key))
+	nodes := make([]string, 0, len(r.nodes))
+	scores := make(map[string]uint64, len(r.nodes))
+	for node, nh := range r.nodes {
+		nodes = append(nodes, node)
+		scores[node] = mix(nh, h)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		if scores[nodes[i]] != scores[nodes[j]] {
+			return scores[nodes[i]] > scores[nodes[j]]
+		}
+		return nodes[i] < nodes[j]
+	})
+	if n < len(nodes) {
+		nodes = nodes[:n]
+	}
+	return nodes
+}
+
+// GetIf gets the node with the highest score for key that ok accepts,
+// or "" if ok rejects them all.
+func (r *Rendezvous) GetIf(key string, ok func(node string) bool) string {
+	for _, node := range r.GetN(key, len(r.nodes)) {
+		if ok(node) {
+			return node
+		}
+	}
+	return ""
+}
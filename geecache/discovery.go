@@ -0,0 +1,141 @@
+/*
+ * @Description:通过geerpc的注册中心发现缓存节点。
+ * 每个节点向注册中心发送心跳注册自己，并定期从注册中心拉取所有存活的节点，更新hash环，
+ * 这样增加一个缓存节点时，其他节点不需要修改配置
+ * @version:
+ * @Author: Steven
+ * @Date: 2023-04-22 15:02:47
+ */
+package geecache
+
+import (
+	"fmt"
+	"geerpc/xclient"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRefreshInterval = time.Second * 10 //默认每10秒从注册中心拉取一次节点列表
+	heartbeatInterval      = time.Minute * 4  //注册中心默认5分钟没有心跳就删除节点
+	minHeartbeatRetry      = time.Second
+	heartbeatTimeout       = time.Second * 5
+)
+
+// Discover registers p with the geerpc registry at registryAddr, e.g.
+// "http://localhost:9999/_geerpc_/registry", keeps it alive with
+// heartbeats, retried until they succeed, and refreshes the peers of p
+// from the registry every refresh (10 seconds if zero or negative). Only
+// http(s) addresses are used as peers, still a registry dedicated to
+// cache nodes is recommended.
+func (p *HTTPPool) Discover(registryAddr string, refresh time.Duration) {
+	discover(p, p.self, registryAddr, refresh, func(addr string) bool {
+		return strings.HasPrefix(addr, "http://") || strings.HasPrefix(addr, "https://")
+	})
+}
+
+// 可以从注册中心更新节点的节点池，HTTPPool和RPCPool
+type peerSet interface {
+	Peers() []string
+	AddPeers(peers ...string)
+	RemovePeers(peers ...string)
+	Log(format string, v ...interface{})
+}
+
+// 向注册中心注册self，之后定期拉取节点列表，accept过滤出该节点池可以使用的地址
+func discover(pool peerSet, self string, registryAddr string, refresh time.Duration, accept func(addr string) bool) {
+	if refresh <= 0 { //time.NewTicker不接受非正数的间隔
+		refresh = defaultRefreshInterval
+	}
+	//第一次心跳是同步的，返回时自己已经在注册中心里了
+	err := sendHeartbeat(registryAddr, self)
+	go heartbeat(pool, registryAddr, self, err)
+	d := xclient.NewGeeRegistryDiscovery(registryAddr, refresh)
+	refreshPeers(pool, d, accept)
+	go func() {
+		t := time.NewTicker(refresh)
+		defer t.Stop()
+		for range t.C {
+			refreshPeers(pool, d, accept)
+		}
+	}()
+}
+
+// 定期发送心跳。geerpc的registry.Heartbeat失败一次就不再发送，注册中心短暂不可用之后节点就会过期，
+// 这里失败时退避重试，直到成功之后再恢复正常的间隔
+func heartbeat(pool peerSet, registryAddr string, self string, err error) {
+	retry := minHeartbeatRetry
+	for {
+		wait := heartbeatInterval
+		if err != nil {
+			pool.Log("heartbeat: %v", err)
+			wait = retry
+			if retry *= 2; retry > heartbeatInterval {
+				retry = heartbeatInterval
+			}
+		} else {
+			retry = minHeartbeatRetry
+		}
+		time.Sleep(wait)
+		err = sendHeartbeat(registryAddr, self)
+	}
+}
+
+// 和geerpc的心跳一样，通过X-Geerpc-Server请求头告诉注册中心自己的地址
+func sendHeartbeat(registryAddr string, self string) error {
+	req, err := http.NewRequest(http.MethodPost, registryAddr, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Geerpc-Server", self)
+	res, err := (&http.Client{Timeout: heartbeatTimeout}).Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("registry returned: %v", res.Status)
+	}
+	return nil
+}
+
+// 从注册中心拉取存活的节点，只增删有变化的节点，其余节点负责的key不受影响
+func refreshPeers(pool peerSet, d xclient.Discovery, accept func(addr string) bool) {
+	servers, err := d.GetAll()
+	if err != nil {
+		pool.Log("refresh peers: %v", err)
+		return
+	}
+	alive := make(map[string]bool, len(servers))
+	for _, s := range servers {
+		if accept(s) {
+			alive[s] = true
+		}
+	}
+	if len(alive) == 0 { //注册中心异常时返回空列表，保留当前的节点
+		return
+	}
+
+	var added, removed []string
+	current := make(map[string]bool)
+	for _, peer := range pool.Peers() {
+		current[peer] = true
+		if !alive[peer] {
+			removed = append(removed, peer)
+		}
+	}
+	for s := range alive {
+		if !current[s] {
+			added = append(added, s)
+		}
+	}
+	sort.Strings(added) //map的遍历顺序是随机的，按加入顺序编号的picker（Jump）依赖这个顺序
+	sort.Strings(removed)
+	if len(added) > 0 || len(removed) > 0 {
+		pool.Log("peers changed, added %v, removed %v", added, removed)
+		pool.AddPeers(added...)
+		pool.RemovePeers(removed...)
+	}
+}
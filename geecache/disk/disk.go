@@ -0,0 +1,320 @@
+/*
+ * @Description:磁盘缓存层，内存放不下的缓存降级到磁盘上，再次访问时提升回内存。
+ * 缓存追加写入段文件，内存中保存key到文件位置的索引；段文件写满之后封存，开始写新的段文件。
+ * 封存的段文件中失效的数据超过一半时压缩：把还有效的数据搬到新的段文件里，删除旧文件。
+ * 磁盘超出限制时，整个删除最早的段文件。
+ * 记录格式：crc32(4字节，校验之后的部分) | 过期时间UnixNano(8字节，0代表永不过期) | 版本(8字节) | key长度(4字节) | value长度(4字节) | key | value
+ * @version:
+ * @Author: Steven
+ * @Date: 2023-04-28 20:05:17
+ */
+package disk
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	headerSize          = 28
+	defaultSegmentBytes = 64 << 20 //不限制磁盘大小时，每个段文件64M
+	minSegmentBytes     = 4 << 10
+	segmentExt          = ".seg"
+)
+
+var errCorrupt = errors.New("disk: corrupt record")
+
+// Store is an append-only file store of values with expiry and a version
+// it keeps but doesn't interpret. Its index is kept in memory, so a Store
+// starts empty: Open removes the segments an earlier Store left in dir.
+// It is safe for concurrent use.
+type Store struct {
+	dir          string
+	maxBytes     int64 //磁盘最多使用的空间，0代表不限制
+	segmentBytes int64 //段文件超过该大小之后封存
+
+	mu       sync.Mutex
+	index    map[string]location
+	segments []*segment //最早的在前面，最后一个是正在写入的
+	nextID   int
+	nbytes   int64 //所有段文件的大小之和
+}
+
+type segment struct {
+	id   int
+	f    *os.File
+	size int64 //文件大小
+	dead int64 //已经失效的记录占用的大小
+}
+
+// 一条记录在段文件中的位置
+type location struct {
+	seg    *segment
+	off    int64
+	size   int64
+	expire time.Time
+}
+
+// Open creates a Store keeping its segments in dir, using at most
+// maxBytes of disk, or no limit if maxBytes is 0.
+func Open(dir string, maxBytes int64) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	old, err := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range old { //索引只在内存中，旧的段文件没有用了
+		if err := os.Remove(name); err != nil {
+			return nil, err
+		}
+	}
+	s := &Store{
+		dir:          dir,
+		maxBytes:     maxBytes,
+		segmentBytes: defaultSegmentBytes,
+		index:        make(map[string]location),
+	}
+	if maxBytes > 0 { //至少分成4个段文件，超出限制时一次只删除1/4
+		s.segmentBytes = maxBytes / 4
+		if s.segmentBytes < minSegmentBytes {
+			s.segmentBytes = minSegmentBytes
+		}
+	}
+	if err := s.roll(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Put stores value under key with its version, replacing the previous
+// value if any.
+func (s *Store) Put(key string, value []byte, expire time.Time, version uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.segments == nil {
+		return os.ErrClosed
+	}
+	if err := s.append(key, value, expire, version); err != nil {
+		return err
+	}
+	if err := s.compact(); err != nil {
+		return err
+	}
+	return s.evict()
+}
+
+// Get returns the value stored under key and its version unless it has
+// expired.
+func (s *Store) Get(key string) (value []byte, expire time.Time, version uint64, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	loc, ok := s.index[key]
+	if !ok {
+		return nil, time.Time{}, 0, false
+	}
+	if !loc.expire.IsZero() && !time.Now().Before(loc.expire) {
+		s.drop(key, loc)
+		return nil, time.Time{}, 0, false
+	}
+	_, value, version, err := s.read(loc)
+	if err != nil { //读不出来的记录当作不存在
+		s.drop(key, loc)
+		return nil, time.Time{}, 0, false
+	}
+	return value, loc.expire, version, true
+}
+
+// Delete removes key from the store. Its bytes are reclaimed when its
+// segment is compacted.
+func (s *Store) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if loc, ok := s.index[key]; ok {
+		s.drop(key, loc)
+	}
+}
+
+// DeleteFunc removes every key for which match returns true, and returns
+// how many were removed.
+func (s *Store) DeleteFunc(match func(key string) bool) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for key, loc := range s.index {
+		if match(key) {
+			s.drop(key, loc)
+			n++
+		}
+	}
+	return n
+}
+
+// Len returns the number of keys in the store.
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.index)
+}
+
+// Bytes returns the size of all segments, including dead records.
+func (s *Store) Bytes() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.nbytes
+}
+
+// Close closes and removes all segments.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var err error
+	for _, seg := range append([]*segment(nil), s.segments...) { //removeSegment会修改s.segments
+		if e := s.removeSegment(seg); e != nil && err == nil {
+			err = e
+		}
+	}
+	s.segments, s.index = nil, nil
+	return err
+}
+
+func (s *Store) drop(key string, loc location) {
+	loc.seg.dead += loc.size
+	delete(s.index, key)
+}
+
+// 追加一条记录到正在写入的段文件，写满时先封存
+func (s *Store) append(key string, value []byte, expire time.Time, version uint64) error {
+	active := s.segments[len(s.segments)-1]
+	size := int64(headerSize + len(key) + len(value))
+	if active.size > 0 && active.size+size > s.segmentBytes {
+		if err := s.roll(); err != nil {
+			return err
+		}
+		active = s.segments[len(s.segments)-1]
+	}
+
+	buf := make([]byte, size)
+	var e int64
+	if !expire.IsZero() {
+		e = expire.UnixNano()
+	}
+	binary.BigEndian.PutUint64(buf[4:], uint64(e))
+	binary.BigEndian.PutUint64(buf[12:], version)
+	binary.BigEndian.PutUint32(buf[20:], uint32(len(key)))
+	binary.BigEndian.PutUint32(buf[24:], uint32(len(value)))
+	copy(buf[headerSize:], key)
+	copy(buf[headerSize+len(key):], value)
+	binary.BigEndian.PutUint32(buf, crc32.ChecksumIEEE(buf[4:]))
+	if _, err := active.f.WriteAt(buf, active.size); err != nil {
+		return err
+	}
+
+	if old, ok := s.index[key]; ok {
+		old.seg.dead += old.size
+	}
+	s.index[key] = location{seg: active, off: active.size, size: size, expire: expire}
+	active.size += size
+	s.nbytes += size
+	return nil
+}
+
+// 读出一条记录并校验
+func (s *Store) read(loc location) (key string, value []byte, version uint64, err error) {
+	buf := make([]byte, loc.size)
+	if _, err := loc.seg.f.ReadAt(buf, loc.off); err != nil {
+		return "", nil, 0, err
+	}
+	if binary.BigEndian.Uint32(buf) != crc32.ChecksumIEEE(buf[4:]) {
+		return "", nil, 0, errCorrupt
+	}
+	version = binary.BigEndian.Uint64(buf[12:])
+	klen := int64(binary.BigEndian.Uint32(buf[20:]))
+	if headerSize+klen > loc.size {
+		return "", nil, 0, errCorrupt
+	}
+	return string(buf[headerSize : headerSize+klen]), buf[headerSize+klen:], version, nil
+}
+
+// 封存正在写入的段文件，创建一个新的
+func (s *Store) roll() error {
+	name := filepath.Join(s.dir, fmt.Sprintf("%09d%s", s.nextID, segmentExt))
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	s.segments = append(s.segments, &segment{id: s.nextID, f: f})
+	s.nextID++
+	return nil
+}
+
+// 压缩失效数据超过一半的封存段文件
+func (s *Store) compact() error {
+	sealed := s.segments[:len(s.segments)-1]
+	var targets []*segment
+	for _, seg := range sealed {
+		if seg.dead*2 > seg.size {
+			targets = append(targets, seg)
+		}
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+	live := make(map[*segment][]string)
+	for key, loc := range s.index {
+		live[loc.seg] = append(live[loc.seg], key)
+	}
+	for _, seg := range targets {
+		for _, key := range live[seg] { //把还有效的记录搬到正在写入的段文件
+			loc := s.index[key]
+			_, value, version, err := s.read(loc)
+			if err != nil {
+				s.drop(key, loc)
+				continue
+			}
+			if err := s.append(key, value, loc.expire, version); err != nil {
+				return err
+			}
+		}
+		if err := s.removeSegment(seg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 超出磁盘限制时，删除最早的段文件，其中的记录全部丢弃
+func (s *Store) evict() error {
+	for s.maxBytes > 0 && s.nbytes > s.maxBytes && len(s.segments) > 1 {
+		oldest := s.segments[0]
+		for key, loc := range s.index {
+			if loc.seg == oldest {
+				delete(s.index, key)
+			}
+		}
+		if err := s.removeSegment(oldest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 关闭并删除段文件
+func (s *Store) removeSegment(seg *segment) error {
+	for i, sg := range s.segments {
+		if sg == seg {
+			s.segments = append(s.segments[:i], s.segments[i+1:]...)
+			break
+		}
+	}
+	s.nbytes -= seg.size
+	seg.f.Close()
+	return os.Remove(seg.f.Name())
+}
@@ -0,0 +1,96 @@
+package disk
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestPutGet(t *testing.T) {
+	s, err := Open(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.Put("Tom", []byte("630"), time.Time{}, 0)
+	s.Put("Jack", []byte("589"), time.Now().Add(-time.Second), 0)
+	s.Put("Tom", []byte("631"), time.Now().Add(time.Hour), 7)
+
+	if v, e, version, ok := s.Get("Tom"); !ok || string(v) != "631" || e.IsZero() || version != 7 {
+		t.Fatalf("expect the latest Tom=631 with its expiry and version, got %q %v %d", v, e, version)
+	}
+	if _, _, _, ok := s.Get("Jack"); ok {
+		t.Fatalf("expired Jack should be a miss")
+	}
+	s.Delete("Tom")
+	if _, _, _, ok := s.Get("Tom"); ok || s.Len() != 0 {
+		t.Fatalf("deleted Tom should be a miss")
+	}
+}
+
+func TestCompactAndEvict(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, 16<<10) //每个段文件4K
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	value := make([]byte, 100)
+
+	// 反复覆盖同样的20个key，旧的记录失效，压缩之后磁盘占用不会一直增长
+	for round := 0; round < 20; round++ {
+		for i := 0; i < 20; i++ {
+			s.Put("key"+strconv.Itoa(i), value, time.Time{}, 0)
+		}
+	}
+	if s.Len() != 20 {
+		t.Fatalf("expect 20 keys, got %d", s.Len())
+	}
+	for i := 0; i < 20; i++ {
+		if _, _, _, ok := s.Get("key" + strconv.Itoa(i)); !ok {
+			t.Fatalf("key%d should survive compaction", i)
+		}
+	}
+	if s.Bytes() > 16<<10 {
+		t.Fatalf("dead records should be compacted, %d bytes used", s.Bytes())
+	}
+
+	// 不同的key超出限制时，最早的段文件被删除
+	for i := 0; i < 1000; i++ {
+		s.Put("new"+strconv.Itoa(i), value, time.Time{}, 0)
+	}
+	if s.Bytes() > 16<<10 {
+		t.Fatalf("store should stay under 16K, got %d", s.Bytes())
+	}
+	if _, _, _, ok := s.Get("key0"); ok {
+		t.Fatalf("the oldest keys should be evicted")
+	}
+	if _, _, _, ok := s.Get("new999"); !ok {
+		t.Fatalf("the newest key should be kept")
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	if len(files) != len(s.segments) {
+		t.Fatalf("expect %d segment files, got %d", len(s.segments), len(files))
+	}
+}
+
+func TestOpenRemovesOldSegments(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := Open(dir, 0)
+	s.Put("Tom", []byte("630"), time.Time{}, 0)
+	s.segments[0].f.Close() //模拟进程退出，没有调用Close
+
+	s, err := Open(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, _, _, ok := s.Get("Tom"); ok {
+		t.Fatalf("a new store should start empty")
+	}
+	if st, err := os.Stat(s.segments[0].f.Name()); err != nil || st.Size() != 0 {
+		t.Fatalf("the old segment should be replaced")
+	}
+}
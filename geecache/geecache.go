@@ -7,10 +7,17 @@
 package geecache
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"geecache/disk"
 	"geecache/singleflight"
 	"log"
+	"math/rand"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // 当我们要获取的数据，在缓存里还没有的时候，我们就需要从数据源获取数据，而不同的缓存数据对应的数据源是不一样的！
@@ -35,112 +42,593 @@ func (f GetterFunc) Get(key string) ([]byte, error) {
 	return f(key) //f为一个匿名函数或者具名函数，都可以通过Get方法，实现调用该函数
 }
 
+// 如果回调函数需要感知请求被取消或者超时，就实现GetterContext接口
+// A GetterContext loads data for a key, giving up once ctx is done.
+type GetterContext interface {
+	GetContext(ctx context.Context, key string) ([]byte, error)
+}
+
+// A GetterContextFunc implements Getter and GetterContext with a function.
+type GetterContextFunc func(ctx context.Context, key string) ([]byte, error)
+
+// Get implements Getter interface function with a background context
+func (f GetterContextFunc) Get(key string) ([]byte, error) {
+	return f(context.Background(), key)
+}
+
+// GetContext implements GetterContext interface function
+func (f GetterContextFunc) GetContext(ctx context.Context, key string) ([]byte, error) {
+	return f(ctx, key)
+}
+
+// 如果回调函数还能决定每一个缓存值的有效期，就实现GetterWithTTL接口
+// 返回的ttl<=0时，使用分组的默认有效期
+// A GetterWithTTL loads data for a key together with how long it stays valid.
+type GetterWithTTL interface {
+	GetWithTTL(key string) ([]byte, time.Duration, error)
+}
+
+// A GetterWithTTLFunc implements Getter and GetterWithTTL with a function.
+type GetterWithTTLFunc func(key string) ([]byte, time.Duration, error)
+
+// Get implements Getter interface function, dropping the ttl
+func (f GetterWithTTLFunc) Get(key string) ([]byte, error) {
+	b, _, err := f(key)
+	return b, err
+}
+
+// GetWithTTL implements GetterWithTTL interface function
+func (f GetterWithTTLFunc) GetWithTTL(key string) ([]byte, time.Duration, error) {
+	return f(key)
+}
+
 // 一个group可以理解为一个缓存命名空间，就是分组的概念
 // 比如学生、老师、家长，就可以是不同的缓存分组
 // A Group is a cache namespace and associated data loaded spread over
 type Group struct {
-	name      string     //分组名
-	getter    Getter     //未获取缓存时，通过该字段，进行调用回调函数来获取缓存值，进而更新到缓存数据库里
-	mainCache cache      //一套并发缓存数据库的维护，通过该字段可以从缓存数据库获取缓存更新缓存
-	peers     PeerPicker //可以通过这，从分布式缓存系统获取缓存数据
-	loader    *singleflight.Group
+	name      string       //分组名
+	getter    Getter       //未获取缓存时，通过该字段，进行调用回调函数来获取缓存值，进而更新到缓存数据库里
+	mainCache shardedCache //一套并发缓存数据库的维护，通过该字段可以从缓存数据库获取缓存更新缓存
+	//热点缓存，保存本节点不负责、但是从远程节点获取过的部分缓存值
+	//避免一个热点key的所有请求都打到负责它的那个节点上
+	hotCache shardedCache
+	negCache shardedCache //未找到缓存，记录数据源中没有的key
+	peers    PeerPicker   //可以通过这，从分布式缓存系统获取缓存数据
+	loader   *singleflight.Group
+	//正在后台刷新的key
+	refreshing sync.Map
+
+	policy        PolicyType    //淘汰策略
+	shards        int           //缓存分片数
+	ttl           time.Duration //缓存默认有效期，0代表永不过期
+	sweepInterval time.Duration //后台清理过期缓存的间隔，0代表只做惰性删除
+
+	snapshotPath     string        //快照文件，为空代表不使用快照
+	snapshotInterval time.Duration //定期写入快照的间隔，0代表不定期写入
+	diskDir          string        //磁盘缓存层的目录，为空代表只使用内存
+	diskBytes        int64         //磁盘缓存层最多使用的空间，0代表不限制
+	negativeTTL      time.Duration //未找到缓存的有效期，0代表不记录
+	staleWindow      time.Duration //缓存过期之后，还可以返回过期值并在后台刷新的时间
+	setter           Setter        //Set时写数据源，为nil代表只写缓存
+	behind           *writeBehind  //不为nil时异步写数据源
+	writeMu          [writeStripes]sync.Mutex
+
+	disk      *disk.Store    //磁盘缓存层，为nil代表只使用内存
+	stop      chan struct{}  //关闭分组时关闭，通知后台任务退出
+	tasks     sync.WaitGroup //正在运行的后台任务
+	closeOnce sync.Once
+
+	// Stats are statistics on the group.
+	Stats Stats
 }
 
-var (
-	mu     sync.RWMutex
-	groups = make(map[string]*Group) //保存着每一个缓存分组名到具体缓存Group结构体实例的映射
+// Stats are per-group statistics.
+type Stats struct {
+	Gets           AtomicInt // any Get request, including from peers
+	CacheHits      AtomicInt // either cache was good
+	PeerLoads      AtomicInt // either remote load or remote cache hit (not an error)
+	PeerErrors     AtomicInt
+	Loads          AtomicInt // (gets - cacheHits)
+	LoadsDeduped   AtomicInt // after singleflight
+	LocalLoads     AtomicInt // total good local loads
+	LocalLoadErrs  AtomicInt // total bad local loads
+	ServerRequests AtomicInt // gets that came over the network from peers
+	NegativeHits   AtomicInt // gets of keys remembered as not found
+	StaleHits      AtomicInt // gets served an expired value while it is refreshed
+}
+
+// An AtomicInt is an int64 to be accessed atomically.
+type AtomicInt int64
+
+// Add atomically adds n to i.
+func (i *AtomicInt) Add(n int64) {
+	atomic.AddInt64((*int64)(i), n)
+}
+
+// Get atomically gets the value of i.
+func (i *AtomicInt) Get() int64 {
+	return atomic.LoadInt64((*int64)(i))
+}
+
+func (i *AtomicInt) String() string {
+	return strconv.FormatInt(i.Get(), 10)
+}
+
+// MarshalJSON reads i atomically, so a *Stats can be encoded while in use.
+func (i *AtomicInt) MarshalJSON() ([]byte, error) {
+	return []byte(i.String()), nil
+}
+
+// A GroupOption configures optional behaviour of a Group in NewGroup.
+type GroupOption func(*Group)
+
+const (
+	defaultSweepInterval = time.Minute
+	hotCacheRatio        = 8  //热点缓存占用cacheBytes的1/8
+	hotCachePercent      = 10 //从远程节点获取到的缓存值，有10%的概率放入热点缓存
 )
 
+// WithTTL sets the default time to live of values loaded into the group.
+// A background sweeper then reclaims expired values every minute unless
+// WithSweepInterval says otherwise.
+func WithTTL(ttl time.Duration) GroupOption {
+	return func(g *Group) {
+		g.ttl = ttl
+		if g.sweepInterval == 0 {
+			g.sweepInterval = defaultSweepInterval
+		}
+	}
+}
+
+// WithShards splits each of the group's caches into n shards keyed by
+// hash, each with its own lock and an equal share of cacheBytes, so that
+// concurrent Gets of different keys rarely contend.
+func WithShards(n int) GroupOption {
+	return func(g *Group) {
+		g.shards = n
+	}
+}
+
+// WithSweepInterval sets how often expired values are reclaimed in the
+// background. Expired values are always treated as misses regardless.
+func WithSweepInterval(interval time.Duration) GroupOption {
+	return func(g *Group) {
+		g.sweepInterval = interval
+	}
+}
+
+// WithDiskTier puts a disk tier of at most maxBytes (0 for no limit)
+// behind the group's main cache. Values evicted from memory are written
+// to segment files in dir instead of being lost, and moved back to memory
+// when they are hit again. dir should not be shared with other groups;
+// what is in it is discarded when the group is created.
+func WithDiskTier(dir string, maxBytes int64) GroupOption {
+	return func(g *Group) {
+		g.diskDir = dir
+		g.diskBytes = maxBytes
+	}
+}
+
 // name:缓存分组名
 // cacheBytes:该缓存可以使用的内存空间大小
 // getter:回调函数
-// NewGroup create a new instance of Group
-func NewGroup(name string, cacheBytes int64, getter Getter) *Group {
-	if getter == nil {
-		panic("nil Getter")
+// opts:可选配置，如默认有效期
+// NewGroup create a new instance of Group in the default Cache, replacing
+// any group with the same name, which is closed first. It panics if
+// getter is nil or the new group fails to start.
+func NewGroup(name string, cacheBytes int64, getter Getter, opts ...GroupOption) *Group {
+	g, err := defaultCache.register(name, cacheBytes, getter, true, opts)
+	if err != nil {
+		panic(err)
 	}
-	mu.Lock()
-	defer mu.Unlock()
+	return g
+}
+
+// 创建分组实例，不负责注册
+func newGroup(name string, cacheBytes int64, getter Getter, opts ...GroupOption) *Group {
 	g := &Group{
-		name:      name,
-		getter:    getter,
-		mainCache: cache{cacheBytes: cacheBytes},
-		loader:    &singleflight.Group{},
+		name:   name,
+		getter: getter,
+		loader: &singleflight.Group{},
+	}
+	for _, opt := range opts {
+		opt(g)
 	}
-	groups[name] = g
+	hotBytes := cacheBytes / hotCacheRatio //从总内存中划出一部分给热点缓存
+	var negBytes int64
+	if g.negativeTTL > 0 {
+		negBytes = cacheBytes / negCacheRatio
+	}
+	g.mainCache = newShardedCache(g.shards, cacheBytes-hotBytes-negBytes, g.policy)
+	g.hotCache = newShardedCache(g.shards, hotBytes, g.policy)
+	g.negCache = newShardedCache(g.shards, negBytes, LRUPolicy)
+	g.mainCache.setStale(g.staleWindow)
+	g.hotCache.setStale(g.staleWindow)
 	return g
 }
 
+// 打开磁盘缓存层、从快照恢复，启动后台任务
+func (g *Group) start() error {
+	if g.diskDir != "" {
+		store, err := disk.Open(g.diskDir, g.diskBytes)
+		if err != nil {
+			return err
+		}
+		g.disk = store
+		g.mainCache.setDisk(store)
+	}
+	g.stop = make(chan struct{})
+	if g.sweepInterval > 0 {
+		g.background(g.sweep)
+	}
+	if g.behind != nil {
+		g.background(func() { g.behind.run(g.stop) })
+	}
+	if g.snapshotPath != "" { //从上一次的快照恢复，重启之后不会全部回源
+		g.restoreFile()
+		if g.snapshotInterval > 0 {
+			g.background(g.snapshotLoop)
+		}
+	}
+	return nil
+}
+
+func (g *Group) background(task func()) {
+	g.tasks.Add(1)
+	go func() {
+		defer g.tasks.Done()
+		task()
+	}()
+}
+
+// Close stops the background work of the group, writing the values
+// still waiting for write-behind first, and removes its disk tier. It
+// doesn't write a snapshot; call Snapshot before if needed. The group
+// must not be used afterwards.
+func (g *Group) Close() error {
+	var err error
+	g.closeOnce.Do(func() {
+		if g.stop != nil {
+			close(g.stop)
+			g.tasks.Wait()
+		}
+		if g.disk != nil {
+			err = g.disk.Close()
+		}
+	})
+	return err
+}
+
+// 后台定期清理过期的缓存，过期的缓存虽然不会被返回，但仍然占用着内存
+func (g *Group) sweep() {
+	t := time.NewTicker(g.sweepInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-g.stop:
+			return
+		}
+		if n := g.mainCache.removeExpired() + g.hotCache.removeExpired() + g.negCache.removeExpired(); n > 0 {
+			log.Printf("[GeeCache] group %s swept %d expired keys", g.name, n)
+		}
+	}
+}
+
 // GetGroup returns the named group previously created with NewGroup, or
 // nil if there's no such group.
 func GetGroup(name string) *Group {
-	mu.RLock()
-	g := groups[name]
-	mu.RUnlock()
-	return g
+	return defaultCache.GetGroup(name)
+}
+
+// Name returns the name of the group.
+func (g *Group) Name() string {
+	return g.name
 }
 
 // 这里就看出来ByteView结构体的作用了！
 // Get value for a key from cache
 func (g *Group) Get(key string) (ByteView, error) {
+	return g.GetContext(context.Background(), key)
+}
+
+// GetContext is like Get, but stops waiting for a peer or the Getter once
+// ctx is cancelled or its deadline passes.
+func (g *Group) GetContext(ctx context.Context, key string) (ByteView, error) {
 	if key == "" {
 		return ByteView{}, fmt.Errorf("key is required")
 	}
+	g.Stats.Gets.Add(1)
 
 	//从缓存数据库获取缓存值
-	if v, ok := g.mainCache.get(key); ok {
-		log.Println("[GeeCache] hit")
-		return v, nil
+	if v, hit, err := g.lookup(key); hit {
+		return v, err
 	}
 	//没获取到，获取缓存值
-	return g.load(key)
+	g.Stats.Loads.Add(1)
+	return g.load(ctx, key)
+}
+
+// 从主缓存、热点缓存、未找到缓存中查找，hit为false时需要加载。
+// 过期但还在后台刷新时间内的值也算命中，同时发起后台刷新
+func (g *Group) lookup(key string) (value ByteView, hit bool, err error) {
+	if v, ok := g.mainCache.get(key); ok {
+		g.Stats.CacheHits.Add(1)
+		if v.stale() {
+			g.Stats.StaleHits.Add(1)
+			g.revalidate(key, false)
+		}
+		return v, true, nil
+	}
+	if v, ok := g.hotCache.get(key); ok {
+		g.Stats.CacheHits.Add(1)
+		if v.stale() {
+			g.Stats.StaleHits.Add(1)
+			g.revalidate(key, true)
+		}
+		return v, true, nil
+	}
+	if err := g.negativeHit(key); err != nil {
+		g.Stats.NegativeHits.Add(1)
+		return ByteView{}, true, err
+	}
+	return ByteView{}, false, nil
 }
 
 // 获取缓存值：缓存数据源有多种源头，比如从本地获取，从远程获取
 // 这里暂时定义，直接从本地获取！
-func (g *Group) load(key string) (value ByteView, err error) {
-	viewi, err := g.loader.Do(key, func() (interface{}, error) {
-		if g.peers != nil { //配置了远程分布式缓存获取算法
-			if peer, ok := g.peers.PickPeer(key); ok { //peer是一个从分布式缓存系统获取缓存数据的http客户端
-				if value, err = g.getFromPeer(peer, key); err == nil {
+func (g *Group) load(ctx context.Context, key string) (ByteView, error) {
+	//相同key的并发请求只加载一次，所有请求都不再等待时才取消加载，每个请求只等待到自己的ctx结束。
+	//fn在单独的协程中执行，调用方可能提前返回，fn里只能用局部变量，结果通过singleflight返回
+	viewi, err := g.loader.DoContext(ctx, key, func(ctx context.Context) (interface{}, error) {
+		//并发的相同请求只有一个会执行到这里
+		g.Stats.LoadsDeduped.Add(1)
+		//peer是一个从分布式缓存系统获取缓存数据的http客户端
+		peers, local := g.pickPeers(key)
+		if local && len(peers) > 0 && !fromPeer(ctx) { //本节点是副本时从第一个节点加载，所有副本上的版本都相同
+			if value, ok, err := g.loadFromPrimary(ctx, key); ok {
+				if err != nil {
+					return nil, err
+				}
+				return value, nil
+			}
+		}
+		if !local {
+			for _, i := range rand.Perm(len(peers)) { //任意一个副本都可以，随机选择分散压力，失败时换下一个
+				epoch := g.negCache.currentEpoch(key)
+				value, err := g.getFromPeer(ctx, peers[i], key)
+				if err == nil {
+					g.Stats.PeerLoads.Add(1)
 					return value, nil
 				}
+				if errors.Is(err, ErrNotFound) { //节点已经查过数据源了，不用再从本地加载
+					g.Stats.PeerLoads.Add(1)
+					g.populateNegative(key, err, epoch)
+					return nil, err
+				}
+				g.Stats.PeerErrors.Add(1)
 				log.Println("[GeeCache] Failed to get from peer", err)
+				if ctx.Err() != nil { //请求已经取消，不用再从本地加载了
+					return nil, ctx.Err()
+				}
 			}
 		}
 
-		return g.getLocally(key)
+		return g.loadLocally(ctx, key)
 	})
 
-	if err == nil {
-		return viewi.(ByteView), nil
+	if err != nil {
+		return ByteView{}, err
+	}
+	return viewi.(ByteView), nil
+}
+
+// 从负责key的第一个节点加载，写入主缓存。第一个节点是本节点或者不可用时ok为false，需要从本地加载
+func (g *Group) loadFromPrimary(ctx context.Context, key string) (value ByteView, ok bool, err error) {
+	peer, self := g.pickPrimary(key)
+	if self {
+		return ByteView{}, false, nil
+	}
+	epoch := g.mainCache.currentEpoch(key)
+	negEpoch := g.negCache.currentEpoch(key)
+	if value, err = peer.GetContext(ctx, g.name, key); err == nil {
+		g.Stats.PeerLoads.Add(1)
+		observeVersion(value.v)
+		g.populateCache(key, value, epoch) //保留第一个节点分配的版本
+		return value, true, nil
+	}
+	if errors.Is(err, ErrNotFound) {
+		g.Stats.PeerLoads.Add(1)
+		g.populateNegative(key, err, negEpoch)
+		return ByteView{}, true, err
 	}
-	return
+	g.Stats.PeerErrors.Add(1)
+	log.Println("[GeeCache] Failed to get from primary", err)
+	if ctx.Err() != nil {
+		return ByteView{}, true, ctx.Err()
+	}
+	return ByteView{}, false, nil
+}
+
+type peerRequestKey struct{}
+
+// 标记来自其他节点的请求。节点之间的成员视图不一致时，两个节点可能都认为对方是第一个节点，
+// 来自节点的请求不再转发给第一个节点，避免互相转发
+func withPeerRequest(ctx context.Context) context.Context {
+	return context.WithValue(ctx, peerRequestKey{}, true)
+}
+
+func fromPeer(ctx context.Context) bool {
+	return ctx.Value(peerRequestKey{}) != nil
 }
 
 // 从远程分布式缓存获取缓存
-func (g *Group) getFromPeer(peer PeerGetter, key string) (ByteView, error) {
-	bytes, err := peer.Get(g.name, key)
+func (g *Group) getFromPeer(ctx context.Context, peer PeerGetter, key string) (ByteView, error) {
+	epoch := g.hotCache.currentEpoch(key)
+	value, err := peer.GetContext(ctx, g.name, key) //返回的ByteView带着远程节点上剩余的有效期
 	if err != nil {
 		return ByteView{}, err
 	}
-	return ByteView{b: bytes}, nil
+	g.populateHotCache(key, value, epoch)
+	return value, nil
+}
+
+// 从远程节点获取到的缓存值，只按概率保留一部分，真正的热点key被请求得多，总会被放进来
+func (g *Group) populateHotCache(key string, value ByteView, epoch uint64) {
+	if rand.Intn(100) < hotCachePercent {
+		g.hotCache.addIfEpoch(key, value, epoch)
+	}
+}
+
+// 从本地获取缓存数据并统计，作为singleflight的回调函数
+func (g *Group) loadLocally(ctx context.Context, key string) (interface{}, error) {
+	value, err := g.getLocally(ctx, key)
+	if err != nil {
+		g.Stats.LocalLoadErrs.Add(1)
+		return nil, err
+	}
+	g.Stats.LocalLoads.Add(1)
+	return value, nil
 }
 
 // 从本地获取缓存数据
-func (g *Group) getLocally(key string) (ByteView, error) {
-	bytes, err := g.getter.Get(key) //调用NewGroup函数第三个参数的匿名函数
+func (g *Group) getLocally(ctx context.Context, key string) (ByteView, error) {
+	epoch := g.mainCache.currentEpoch(key) //加载期间如果缓存被删除，加载到的值就不能写入缓存了
+	version := nextVersion()               //开始加载时就分配版本，比它晚开始的加载先完成时，不会被它覆盖
+	negEpoch := g.negCache.currentEpoch(key)
+	var (
+		bytes []byte
+		ttl   time.Duration
+		err   error
+	)
+	if gt, ok := g.getter.(GetterWithTTL); ok { //回调函数可以决定缓存值的有效期
+		bytes, ttl, err = gt.GetWithTTL(key)
+	} else if gc, ok := g.getter.(GetterContext); ok { //回调函数可以感知请求取消
+		bytes, err = gc.GetContext(ctx, key)
+	} else {
+		bytes, err = g.getter.Get(key) //调用NewGroup函数第三个参数的匿名函数
+	}
 	if err != nil {
+		g.populateNegative(key, err, negEpoch)
 		return ByteView{}, err
 
 	}
-	value := ByteView{b: cloneBytes(bytes)} //将缓存值保存到结构体ByteView中
-	g.populateCache(key, value)
+	value := g.newView(bytes, ttl) //将缓存值保存到结构体ByteView中
+	value.v = version
+	g.populateCache(key, value, epoch)
 	return value, nil
 }
 
-func (g *Group) populateCache(key string, value ByteView) {
-	g.mainCache.add(key, value)
+// 拷贝回调函数返回的值，ttl<=0时使用分组默认的有效期
+func (g *Group) newView(bytes []byte, ttl time.Duration) ByteView {
+	if ttl <= 0 {
+		ttl = g.ttl
+	}
+	value := ByteView{b: cloneBytes(bytes), v: nextVersion()}
+	if ttl > 0 {
+		value.e = time.Now().Add(ttl)
+	}
+	return value
+}
+
+func (g *Group) populateCache(key string, value ByteView, epoch uint64) {
+	g.mainCache.addIfEpoch(key, value, epoch)
+}
+
+// Remove drops key from the local cache and asks every peer owning key
+// to drop it too, so the next Get loads a fresh value. Owners that are
+// down are asked as well; Remove returns an error if one can't be
+// reached.
+func (g *Group) Remove(key string) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	g.removeLocally(key)
+	var err error
+	for _, peer := range g.pickOwners(key) { //缓存存在远程节点上，通知所有副本删除，包括不健康的副本
+		if peer == nil {
+			continue
+		}
+		if e := peer.Remove(g.name, key); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// 只删除本节点上的缓存
+func (g *Group) removeLocally(key string) {
+	g.mainCache.remove(key)
+	g.hotCache.remove(key)
+	g.negCache.remove(key)
+	g.loader.Forget(key) //之后的Get不再等待删除之前就开始的加载
+}
+
+// 删除本节点上所有match返回true的缓存，返回主缓存和热点缓存中删除的条数
+func (g *Group) removeFuncLocally(match func(key string) bool) int {
+	n := g.mainCache.removeFunc(match)
+	n += g.hotCache.removeFunc(match)
+	g.negCache.removeFunc(match)
+	g.loader.ForgetFunc(match)
+	return n
+}
+
+// CacheType represents a type of cache.
+type CacheType int
+
+const (
+	// The MainCache is the cache for items that this peer is the
+	// owner for.
+	MainCache CacheType = iota + 1
+
+	// The HotCache is the cache for items that seem popular
+	// enough to replicate to this node, even though it's not the
+	// owner.
+	HotCache
+)
+
+// CacheStats returns stats about the provided cache within the group.
+func (g *Group) CacheStats(which CacheType) CacheStats {
+	switch which {
+	case MainCache:
+		return g.mainCache.stats()
+	case HotCache:
+		return g.hotCache.stats()
+	default:
+		return CacheStats{}
+	}
+}
+
+// 找到负责key的远程节点，local表示本节点也负责key，应该从本地加载
+// 开启了副本时key由多个节点负责，否则最多只有一个
+func (g *Group) pickPeers(key string) (peers []PeerGetter, local bool) {
+	if g.peers == nil { //没有配置远程分布式缓存获取算法
+		return nil, true
+	}
+	if rp, ok := g.peers.(ReplicaPicker); ok {
+		peers, self := rp.PickReplicas(key)
+		return peers, self || len(peers) == 0
+	}
+	if peer, ok := g.peers.PickPeer(key); ok {
+		return []PeerGetter{peer}, false
+	}
+	return nil, true
+}
+
+// 负责key的所有节点，按hash环上的顺序，不考虑健康状态和负载，nil代表本节点。
+// 节点池不能告诉所有负责的节点时，和Get一样选择
+func (g *Group) pickOwners(key string) []PeerGetter {
+	if op, ok := g.peers.(OwnerPicker); ok {
+		if owners := op.PickOwners(key); len(owners) > 0 {
+			return owners
+		}
+		return []PeerGetter{nil} //还没有设置节点
+	}
+	peers, local := g.pickPeers(key)
+	if local {
+		return append([]PeerGetter{nil}, peers...)
+	}
+	return peers
 }
 
 // 注册分布式缓存操作权到该分组下
@@ -0,0 +1,156 @@
+/*
+ * @Description:节点健康检查与熔断。
+ * 被动检查：请求节点连续失败maxFailures次之后熔断，熔断期间PickPeer跳过该节点，
+ * key按hash环顺时针交给下一个健康的节点；熔断openTimeout之后进入半开状态，放行一个探测请求，
+ * 成功则恢复，失败则继续熔断。
+ * 主动检查：定期请求每个节点的健康检查地址，节点恢复之后不用等到有请求才能发现
+ * @version:
+ * @Author: Steven
+ * @Date: 2023-04-24 19:45:10
+ */
+package geecache
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxFailures = 3                //连续失败3次熔断
+	defaultOpenTimeout = time.Second * 10 //熔断10秒之后放行探测请求
+	healthPath         = "_health"        //GET /_geecache/_health 健康检查地址
+	defaultHealthCheck = time.Second * 5  //HealthCheck的间隔不大于0时使用
+)
+
+type breakerState int
+
+const (
+	stateClosed   breakerState = iota // 正常
+	stateOpen                         // 熔断，不选择该节点
+	stateHalfOpen                     // 半开，已经放行了一个探测请求，等待结果
+)
+
+// 一个节点的健康状态
+type peerHealth struct {
+	mu          sync.Mutex
+	state       breakerState
+	failures    int       //连续失败次数
+	since       time.Time //进入当前状态的时间
+	maxFailures int
+	openTimeout time.Duration
+}
+
+func newPeerHealth() *peerHealth {
+	return &peerHealth{maxFailures: defaultMaxFailures, openTimeout: defaultOpenTimeout}
+}
+
+// 节点是否可以被选择。熔断超时之后放行一个探测请求，探测结果迟迟没有回来时再放行一个
+func (h *peerHealth) available() bool {
+	if h == nil {
+		return true
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.state == stateClosed {
+		return true
+	}
+	if time.Since(h.since) < h.openTimeout {
+		return false
+	}
+	h.state, h.since = stateHalfOpen, time.Now()
+	return true
+}
+
+// 记录一次请求的结果。ctx取消导致的失败不是节点的问题，不计入
+func (h *peerHealth) record(ctx context.Context, err error) {
+	if h == nil || (err != nil && ctx.Err() != nil) {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err == nil {
+		h.state, h.failures = stateClosed, 0
+		return
+	}
+	h.failures++
+	if h.state == stateHalfOpen || h.failures >= h.maxFailures {
+		h.state, h.since = stateOpen, time.Now()
+	}
+}
+
+func (h *peerHealth) healthy() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.state == stateClosed
+}
+
+// HealthCheck probes every peer of the pool each interval, so that a
+// peer that recovers is used again without waiting for live traffic to
+// probe it, and a peer that dies is skipped before requests fail on it.
+// An interval <= 0 means 5 seconds.
+func (p *HTTPPool) HealthCheck(interval time.Duration) {
+	if interval <= 0 { //time.NewTicker不接受非正数的间隔
+		interval = defaultHealthCheck
+	}
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for range t.C {
+			p.probePeers(interval)
+		}
+	}()
+}
+
+func (p *HTTPPool) probePeers(timeout time.Duration) {
+	p.mu.Lock()
+	getters := make([]*httpGetter, 0, len(p.httpGetters))
+	for peer, getter := range p.httpGetters {
+		if peer != p.self {
+			getters = append(getters, getter)
+		}
+	}
+	p.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, getter := range getters {
+		wg.Add(1)
+		go func(getter *httpGetter) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			err := getter.ping(ctx)
+			if err != nil && ctx.Err() == context.DeadlineExceeded { //超时算作节点的问题
+				ctx = context.Background()
+			}
+			getter.health.record(ctx, err)
+		}(getter)
+	}
+	wg.Wait()
+}
+
+// 请求节点的健康检查地址
+func (h *httpGetter) ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.baseURL+healthPath, nil)
+	if err != nil {
+		return err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return errUnhealthy
+	}
+	return nil
+}
+
+// Healthy reports whether peer is in the pool and not tripped.
+func (p *HTTPPool) Healthy(peer string) bool {
+	p.mu.Lock()
+	getter, ok := p.httpGetters[peer]
+	p.mu.Unlock()
+	return ok && getter.health.healthy()
+}
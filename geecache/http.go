@@ -7,38 +7,54 @@
 package geecache
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"geecache/consistenthash"
+	"geecache/wire"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 const (
 	defaultBasePath = "/_geecache/"
 	defaultReplicas = 50
+	ttlHeader       = "X-Geecache-Ttl"     //缓存值在所属节点上剩余的有效期，没有该头代表永不过期
+	versionHeader   = "X-Geecache-Version" //缓存值的版本。PUT请求带有该头时是副本，按该版本只写缓存，不写数据源
+	expectHeader    = "X-Geecache-Expect"  //PUT请求带有该头时是CompareAndSet，值为期望的版本
+	statsPath       = "_stats"             //GET /_geecache/_stats 返回所有分组的统计信息
 )
 
 // HTTPPool implements PeerPicker for a pool of HTTP peers.
 type HTTPPool struct {
 	// this peer's base URL, e.g. "https://example.net:8000"
-	self     string              //记录自己的地址，包括主机名/IP 和端口
-	basePath string              //节点间通讯地址的前缀，默认是 /_geecache/。就是分布式集群缓存节点见通信地址前缀
-	mu       sync.Mutex          // guards peers and httpGetters
-	peers    *consistenthash.Map //一致性哈希算法的 Map
+	self     string                //记录自己的地址，包括主机名/IP 和端口
+	cache    *Cache                //从该缓存实例中查找分组
+	basePath string                //节点间通讯地址的前缀，默认是 /_geecache/。就是分布式集群缓存节点见通信地址前缀
+	mu       sync.Mutex            // guards peers and httpGetters
+	peers    consistenthash.Picker //选择节点的算法，默认是一致性哈希算法的 Map
 	//映射远程节点与对应的 httpGetter。每一个远程节点对应一个 httpGetter，因为 httpGetter 与远程节点的地址 baseURL 有关。
 	httpGetters map[string]*httpGetter // keyed by e.g. "http://10.0.0.2:8008"
+	replication int                    //每个key保存在几个节点上，默认1个
+	newPicker   func() consistenthash.Picker
+	bus         invalidationBus            //失效广播
+	adminAuth   func(r *http.Request) bool //管理接口的鉴权，为nil时管理接口不可用
+	peerToken   string                     //节点之间写入、删除、失效请求的令牌，为空时不鉴权
 }
 
-// NewHTTPPool initializes an HTTP pool of peers.
+// NewHTTPPool initializes an HTTP pool of peers serving the groups of the
+// default Cache.
 func NewHTTPPool(self string) *HTTPPool {
-	return &HTTPPool{
-		self:     self,
-		basePath: defaultBasePath,
-	}
+	return defaultCache.NewHTTPPool(self)
 }
 
 // Log info with server name
@@ -49,9 +65,32 @@ func (p *HTTPPool) Log(format string, v ...interface{}) {
 // ServeHTTP handle all http requests
 func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if !strings.HasPrefix(r.URL.Path, p.basePath) { //请求的地址不是以basePath开头的，不允许请求！
-		panic("HTTPPool serving unexpected path: " + r.URL.Path)
+		http.NotFound(w, r)
+		return
+	}
+	if r.URL.Path == p.basePath+healthPath { //健康检查很频繁，不打日志
+		w.Write([]byte("ok"))
+		return
 	}
 	p.Log("%s %s", r.Method, r.URL.Path)
+	if r.URL.Path == p.basePath+statsPath {
+		p.serveStats(w, r)
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, p.basePath+adminPath) {
+		p.serveAdmin(w, r, r.URL.Path[len(p.basePath+adminPath):])
+		return
+	}
+	if r.URL.Path == p.basePath+invalidatePath {
+		if p.checkPeer(w, r) {
+			p.serveInvalidate(w, r)
+		}
+		return
+	}
+	if r.Method == http.MethodPost && r.URL.Path == p.basePath { //请求体是一个二进制协议的请求帧
+		p.serveFrame(w, r)
+		return
+	}
 	// /<basepath>/<groupname>/<key> required
 	parts := strings.SplitN(r.URL.Path[len(p.basePath):], "/", 2)
 	if len(parts) != 2 {
@@ -62,81 +101,677 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	groupName := parts[0]
 	key := parts[1]
 
-	group := GetGroup(groupName) //根据分组名获取该分组实例信息
+	if (r.Method == http.MethodDelete || r.Method == http.MethodPut) && !p.checkPeer(w, r) {
+		return
+	}
+	if r.Method == http.MethodDelete { //其他节点通知本节点删除缓存
+		group := p.cache.GetGroup(groupName)
+		if group == nil {
+			http.Error(w, "no such group: "+groupName, http.StatusNotFound)
+			return
+		}
+		group.removeLocally(key)
+		return
+	}
+	if r.Method == http.MethodPut { //其他节点把写入的值发给本节点
+		p.serveSet(w, r, groupName, key)
+		return
+	}
+
+	p.writeResponse(w, r, p.cache.get(r.Context(), groupName, key))
+}
+
+// 写入缓存值，请求体就是缓存值，写入后的版本放在响应头里。版本不匹配时返回409
+func (p *HTTPPool) serveSet(w http.ResponseWriter, r *http.Request, groupName string, key string) {
+	group := p.cache.GetGroup(groupName)
 	if group == nil {
 		http.Error(w, "no such group: "+groupName, http.StatusNotFound)
 		return
 	}
-
-	view, err := group.Get(key) //获取缓存值
+	value, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var version, expected uint64
+	if v := r.Header.Get(expectHeader); v != "" {
+		if expected, err = strconv.ParseUint(v, 10, 64); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		version, err = group.compareAndSetLocally(r.Context(), key, expected, value)
+	} else {
+		if v := r.Header.Get(versionHeader); v != "" {
+			if version, err = strconv.ParseUint(v, 10, 64); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		version, err = group.setLocally(r.Context(), key, value, version)
+	}
+	if errors.Is(err, ErrVersionMismatch) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	w.Header().Set(versionHeader, strconv.FormatUint(version, 10))
+}
+
+// 从分组中获取缓存值，结果统一放到协议的响应消息里
+func (c *Cache) get(ctx context.Context, groupName string, key string) *wire.Response {
+	res := &wire.Response{Group: groupName, Key: key}
+	group := c.GetGroup(groupName) //根据分组名获取该分组实例信息
+	if group == nil {
+		res.Code, res.Err = wire.CodeNoGroup, "no such group: "+groupName
+		return res
+	}
+
+	group.Stats.ServerRequests.Add(1)
+	view, err := group.GetContext(withPeerRequest(ctx), key) //获取缓存值，请求方断开时不再继续加载
+	if err != nil {
+		res.Code, res.Err = codeOf(err), err.Error()
+		return res
+	}
+	res.Value, res.TTL, res.Version = view.b, ttlOf(view), view.v
+	return res
+}
+
+// 处理POST过来的请求帧
+func (p *HTTPPool) serveFrame(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var req wire.Request
+	if err := req.UnmarshalBinary(body); err != nil {
+		p.writeResponse(w, r, &wire.Response{Code: wire.CodeBadRequest, Err: err.Error()})
+		return
+	}
+	if len(req.Keys) > 0 { //批量获取
+		p.writeBatch(w, p.cache.getMany(r.Context(), req.Group, req.Keys))
+		return
+	}
+	p.writeResponse(w, r, p.cache.get(r.Context(), req.Group, req.Key))
+}
+
+// 批量获取缓存值，每个key一个响应消息
+func (c *Cache) getMany(ctx context.Context, groupName string, keys []string) *wire.BatchResponse {
+	res := &wire.BatchResponse{Items: make([]wire.Response, len(keys))}
+	group := c.GetGroup(groupName)
+	for i, key := range keys {
+		res.Items[i] = wire.Response{Group: groupName, Key: key}
+		if group == nil {
+			res.Items[i].Code, res.Items[i].Err = wire.CodeNoGroup, "no such group: "+groupName
+		}
+	}
+	if group == nil {
+		return res
+	}
+
+	group.Stats.ServerRequests.Add(int64(len(keys)))
+	for i, r := range group.GetManyContext(withPeerRequest(ctx), keys) {
+		if r.Err != nil {
+			res.Items[i].Code, res.Items[i].Err = codeOf(r.Err), r.Err.Error()
+			continue
+		}
+		res.Items[i].Value, res.Items[i].TTL, res.Items[i].Version = r.Value.b, ttlOf(r.Value), r.Value.v
+	}
+	return res
+}
+
+func (p *HTTPPool) writeBatch(w http.ResponseWriter, res *wire.BatchResponse) {
+	body, _ := res.MarshalBinary()
+	w.Header().Set("Content-Type", wire.ContentType)
+	w.Write(body)
+}
+
+// 缓存值剩余的有效期，0代表永不过期
+func ttlOf(view ByteView) time.Duration {
+	e := view.Expire()
+	if e.IsZero() {
+		return 0
+	}
+	if ttl := time.Until(e); ttl > 0 {
+		return ttl
+	}
+	return 1 //刚好过期了，TTL为0会被当成永不过期
+}
+
+// 加载失败的错误对应的结果码，数据源中没有该key时，请求方不需要再自己加载
+func codeOf(err error) wire.Code {
+	if errors.Is(err, ErrNotFound) {
+		return wire.CodeNotFound
+	}
+	return wire.CodeLoadError
+}
+
+// 协议中的结果码对应的HTTP状态码
+func statusOf(code wire.Code) int {
+	switch code {
+	case wire.CodeOK:
+		return http.StatusOK
+	case wire.CodeBadRequest:
+		return http.StatusBadRequest
+	case wire.CodeNoGroup, wire.CodeNotFound:
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// 内容协商：请求方支持二进制协议(POST请求帧，或者Accept中带有wire.ContentType)时返回响应帧，
+// 否则按老的格式返回原始字节，有效期放在头部，这样新老节点可以混合部署
+func (p *HTTPPool) writeResponse(w http.ResponseWriter, r *http.Request, res *wire.Response) {
+	if r.Method == http.MethodPost || strings.Contains(r.Header.Get("Accept"), wire.ContentType) {
+		body, _ := res.MarshalBinary()
+		w.Header().Set("Content-Type", wire.ContentType)
+		w.WriteHeader(statusOf(res.Code))
+		w.Write(body)
+		return
+	}
 
+	if res.Code != wire.CodeOK {
+		http.Error(w, res.Err, statusOf(res.Code))
+		return
+	}
+	if res.TTL > 0 {
+		w.Header().Set(ttlHeader, res.TTL.String())
+	}
+	if res.Version != 0 {
+		w.Header().Set(versionHeader, strconv.FormatUint(res.Version, 10))
+	}
 	w.Header().Set("Content-Type", "application/octet-stream")
-	w.Write(view.ByteSlice())
+	w.Write(res.Value)
+}
+
+// 一个分组的统计信息
+type groupStats struct {
+	Stats     *Stats
+	MainCache CacheStats
+	HotCache  CacheStats
+}
+
+// 以JSON返回统计信息，可以通过?group=<groupname>只查看一个分组
+func (p *HTTPPool) serveStats(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("group")
+	stats := make(map[string]groupStats)
+	for _, g := range p.cache.Groups() {
+		if name != "" && g.name != name {
+			continue
+		}
+		stats[g.name] = groupStats{
+			Stats:     &g.Stats,
+			MainCache: g.CacheStats(MainCache),
+			HotCache:  g.CacheStats(HotCache),
+		}
+	}
+	if name != "" && len(stats) == 0 {
+		http.Error(w, "no such group: "+name, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
 }
 
 type httpGetter struct { //实现了peers.go文件中的接口PeerGetter
 	baseURL string
+	health  *peerHealth //每次请求的结果都会记录下来，连续失败时熔断
+	peer    string
+	loads   consistenthash.LoadTracker //不为nil时，记录正在向该节点发送的请求数
+	token   string                     //写入、删除请求带上的令牌
+}
+
+// 记录一个请求开始，返回的函数在请求结束时调用
+func (h *httpGetter) begin() (done func()) {
+	if h.loads == nil {
+		return func() {}
+	}
+	h.loads.Inc(h.peer)
+	return func() { h.loads.Done(h.peer) }
 }
 
-func (h *httpGetter) Get(group string, key string) ([]byte, error) {
-	u := fmt.Sprintf(
+var errUnhealthy = errors.New("peer is unhealthy")
+
+func (h *httpGetter) url(group string, key string) string {
+	return fmt.Sprintf(
 		"%v%v/%v",
 		h.baseURL,
 		url.QueryEscape(group), //QueryEscape函数对group进行转码使之可以安全的用在URL查询里。
 		url.QueryEscape(key),
-	) //u此时是一个url
-	res, err := http.Get(u) //向u发送一个GET请求
+	)
+}
+
+func (h *httpGetter) Get(group string, key string) (ByteView, error) {
+	return h.GetContext(context.Background(), group, key)
+}
+
+func (h *httpGetter) GetContext(ctx context.Context, group string, key string) (ByteView, error) {
+	defer h.begin()()
+	u := h.url(group, key) //u此时是一个url
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
 	if err != nil {
-		return nil, err
+		return ByteView{}, err
+	}
+	//老节点不认识二进制协议，会忽略Accept返回原始字节
+	req.Header.Set("Accept", wire.ContentType+", application/octet-stream")
+	res, err := http.DefaultClient.Do(req) //向u发送一个GET请求，ctx结束时请求会被中断
+	h.health.record(ctx, err)
+	if err != nil {
+		return ByteView{}, err
 	}
 	defer res.Body.Close() //关闭该请求
 
+	if strings.HasPrefix(res.Header.Get("Content-Type"), wire.ContentType) {
+		return readFrame(res)
+	}
+
 	//因为res的状态码如果不是2xx，err一样为nil，所以这里需要判断res.StatusCode != http.StatusOK
 	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("server returned: %v", res.Status)
+		return ByteView{}, fmt.Errorf("server returned: %v", res.Status)
 	}
 
 	bytes, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return ByteView{}, fmt.Errorf("reading response body: %v", err)
+	}
+
+	view := ByteView{b: bytes}
+	if v := res.Header.Get(ttlHeader); v != "" { //按远程节点剩余的有效期，计算本地的过期时间
+		ttl, err := time.ParseDuration(v)
+		if err != nil {
+			return ByteView{}, fmt.Errorf("parsing %s header: %v", ttlHeader, err)
+		}
+		view.e = time.Now().Add(ttl)
+	}
+	if v := res.Header.Get(versionHeader); v != "" {
+		if view.v, err = strconv.ParseUint(v, 10, 64); err != nil {
+			return ByteView{}, fmt.Errorf("parsing %s header: %v", versionHeader, err)
+		}
+	}
+	return view, nil
+}
+
+// 解析响应帧，错误和有效期都在帧里
+func readFrame(res *http.Response) (ByteView, error) {
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return ByteView{}, fmt.Errorf("reading response body: %v", err)
+	}
+	var out wire.Response
+	if err := out.UnmarshalBinary(body); err != nil {
+		return ByteView{}, err
+	}
+	return viewOf(&out)
+}
+
+// 把响应消息转换为ByteView，按剩余的有效期计算本地的过期时间
+func viewOf(res *wire.Response) (ByteView, error) {
+	switch res.Code {
+	case wire.CodeOK:
+	case wire.CodeNotFound:
+		return ByteView{}, &notFoundError{msg: res.Err}
+	default:
+		return ByteView{}, fmt.Errorf("server returned: %v", res.Err)
+	}
+	view := ByteView{b: res.Value, v: res.Version}
+	if res.TTL > 0 {
+		view.e = time.Now().Add(res.TTL)
+	}
+	return view, nil
+}
+
+// GetMany fetches many keys of group in one POST of a request frame.
+func (h *httpGetter) GetMany(ctx context.Context, group string, keys []string) ([]Result, error) {
+	defer h.begin()()
+	body, _ := (&wire.Request{Group: group, Keys: keys}).MarshalBinary()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.baseURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", wire.ContentType)
+	res, err := http.DefaultClient.Do(req)
+	h.health.record(ctx, err)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	//老节点不支持批量获取，会返回400
+	if res.StatusCode != http.StatusOK || !strings.HasPrefix(res.Header.Get("Content-Type"), wire.ContentType) {
+		return nil, fmt.Errorf("server returned: %v", res.Status)
+	}
+	data, err := ioutil.ReadAll(res.Body)
 	if err != nil {
 		return nil, fmt.Errorf("reading response body: %v", err)
 	}
+	var out wire.BatchResponse
+	if err := out.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	results := make([]Result, len(out.Items))
+	for i := range out.Items {
+		results[i].Key = out.Items[i].Key
+		results[i].Value, results[i].Err = viewOf(&out.Items[i])
+	}
+	return results, nil
+}
 
-	return bytes, nil
+func (h *httpGetter) Remove(group string, key string) error {
+	req, err := http.NewRequest(http.MethodDelete, h.url(group, key), nil)
+	if err != nil {
+		return err
+	}
+	setPeerToken(req, h.token)
+	res, err := http.DefaultClient.Do(req)
+	h.health.record(req.Context(), err)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("server returned: %v", res.Status)
+	}
+	return nil
+}
+
+// Set sends value to the peer with a PUT request.
+func (h *httpGetter) Set(ctx context.Context, group string, key string, value []byte, version uint64) (uint64, error) {
+	header := http.Header{}
+	if version != 0 {
+		header.Set(versionHeader, strconv.FormatUint(version, 10))
+	}
+	return h.put(ctx, group, key, value, header)
+}
+
+// CompareAndSet sends value to the peer with a PUT request carrying the
+// expected version.
+func (h *httpGetter) CompareAndSet(ctx context.Context, group string, key string, expected uint64, value []byte) (uint64, error) {
+	header := http.Header{}
+	header.Set(expectHeader, strconv.FormatUint(expected, 10))
+	return h.put(ctx, group, key, value, header)
+}
+
+// 发送PUT请求，返回写入后的版本
+func (h *httpGetter) put(ctx context.Context, group string, key string, value []byte, header http.Header) (uint64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, h.url(group, key), bytes.NewReader(value))
+	if err != nil {
+		return 0, err
+	}
+	req.Header = header
+	setPeerToken(req, h.token)
+	res, err := http.DefaultClient.Do(req)
+	h.health.record(ctx, err)
+	if err != nil {
+		return 0, unreachableError{err}
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusConflict {
+		return 0, ErrVersionMismatch
+	}
+	if res.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(res.Body)
+		return 0, fmt.Errorf("server returned: %v: %s", res.Status, bytes.TrimSpace(msg))
+	}
+	version, err := strconv.ParseUint(res.Header.Get(versionHeader), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parsing %s header: %v", versionHeader, err)
+	}
+	return version, nil
 }
 
 // 在ide和编译期验证了httpGetter实现了PeerGetter接口，而不是在使用时，让错误尽早暴露出来，而不是上线后！
 var _ PeerGetter = (*httpGetter)(nil)
+var _ BatchPeerGetter = (*httpGetter)(nil)
+var _ PeerSetter = (*httpGetter)(nil)
 
 //还可以这么使用
 //var _ PeerGetter = &httpGetter{}
 
 // 一致性hash初始化，生成hash环，为每一个节点配置一个客户端
+// Set replaces all peers of the pool. Use AddPeers and RemovePeers to
+// change membership at runtime.
 func (p *HTTPPool) Set(peers ...string) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	p.peers = consistenthash.New(defaultReplicas, nil) //一致性hash map结构体实例化
-	p.peers.Add(peers...)                              //生成hash 环
+	p.peers = p.picker()      //一致性hash map结构体实例化
+	addSorted(p.peers, peers) //生成hash 环
 	p.httpGetters = make(map[string]*httpGetter, len(peers))
 	for _, peer := range peers { //为每一个节点，初始化一个httpGetter客户端
-		p.httpGetters[peer] = &httpGetter{baseURL: peer + p.basePath}
+		p.httpGetters[peer] = p.newGetter(peer)
+	}
+	p.syncOutboxes()
+}
+
+// SetWeighted is like Set, but each peer owns a share of the keys in
+// proportion to its weight, e.g. its cacheBytes in megabytes, so that
+// bigger boxes take more. Every node of the pool must use the same
+// weights. Weights are ignored if the Picker given to SetPicker isn't a
+// consistenthash.WeightedPicker.
+func (p *HTTPPool) SetWeighted(weights map[string]int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.peers = p.picker()
+	wp, weighted := p.peers.(consistenthash.WeightedPicker)
+	p.httpGetters = make(map[string]*httpGetter, len(weights))
+	for peer := range weights {
+		p.httpGetters[peer] = p.newGetter(peer)
+	}
+	for _, peer := range sortedPeers(p.httpGetters) { //按节点名的顺序加入，不受map遍历顺序的影响
+		if weighted {
+			wp.AddWeighted(peer, weights[peer]) //权重越大，虚拟节点越多，负责的key越多
+		} else {
+			p.peers.Add(peer)
+		}
+	}
+	p.syncOutboxes()
+}
+
+func (p *HTTPPool) newGetter(peer string) *httpGetter {
+	h := &httpGetter{baseURL: peer + p.basePath, health: newPeerHealth(), peer: peer, token: p.peerToken}
+	if lt, ok := p.peers.(consistenthash.LoadTracker); ok { //按负载选择节点时，每个请求都要告诉选择算法
+		h.loads = lt
+	}
+	return h
+}
+
+// SetPicker replaces the consistent hash ring used to pick the owner of
+// a key with the Picker newPicker returns, such as a Bounded, Jump or
+// Rendezvous. It takes effect on the next Set, so call it before Set.
+// Every node of the pool must use the same kind of Picker. Peers are
+// added to the Picker in sorted order, and a Jump, which numbers peers in
+// the order they were added, is rebuilt on every AddPeers, so that nodes
+// with the same peers agree on who owns a key however they learnt them.
+func (p *HTTPPool) SetPicker(newPicker func() consistenthash.Picker) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.newPicker = newPicker
+}
+
+func (p *HTTPPool) picker() consistenthash.Picker {
+	if p.newPicker != nil {
+		return p.newPicker()
+	}
+	return consistenthash.New(defaultReplicas, nil)
+}
+
+// AddPeers adds peers to the pool. Only the key ranges the new peers take
+// over move; peers already in the pool are ignored.
+func (p *HTTPPool) AddPeers(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		p.peers = p.picker()
+		p.httpGetters = make(map[string]*httpGetter, len(peers))
+	}
+	var added []string
+	for _, peer := range peers {
+		if _, ok := p.httpGetters[peer]; ok {
+			continue
+		}
+		p.httpGetters[peer] = p.newGetter(peer)
+		added = append(added, peer)
 	}
+	if _, ok := p.peers.(*consistenthash.Jump); ok && len(added) > 0 {
+		//Jump按加入顺序编号，按排好序的所有节点重建，编号只取决于有哪些节点
+		p.peers = p.picker()
+		addSorted(p.peers, sortedPeers(p.httpGetters))
+	} else {
+		addSorted(p.peers, added) //只把新节点的虚拟节点加入hash环
+	}
+	p.syncOutboxes()
+}
+
+// RemovePeers removes peers from the pool. Only the keys they owned move
+// to other peers.
+func (p *HTTPPool) RemovePeers(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		return
+	}
+	var removed []string
+	for _, peer := range peers {
+		if _, ok := p.httpGetters[peer]; !ok {
+			continue
+		}
+		delete(p.httpGetters, peer)
+		removed = append(removed, peer)
+	}
+	p.peers.Remove(removed...)
+	p.syncOutboxes()
+}
+
+// Peers returns the peers in the pool, sorted.
+func (p *HTTPPool) Peers() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return sortedPeers(p.httpGetters)
+}
+
+// 排好序的节点列表
+func sortedPeers(getters map[string]*httpGetter) []string {
+	peers := make([]string, 0, len(getters))
+	for peer := range getters {
+		peers = append(peers, peer)
+	}
+	sort.Strings(peers)
+	return peers
+}
+
+// 按节点名的顺序加入picker，同样的节点总是以同样的顺序加入
+func addSorted(picker consistenthash.Picker, peers []string) {
+	sorted := append([]string(nil), peers...)
+	sort.Strings(sorted)
+	picker.Add(sorted...)
 }
 
 // 选择节点，如果缓存没存储在当前请求的节点上，那么返回存储缓存的HTTP客户端，进而可以通过该客户端获取缓存
 func (p *HTTPPool) PickPeer(key string) (PeerGetter, bool) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	// p.peers.Get(key)：获取缓存key对应的节点，即缓存key的缓存数据应该存在哪个节点上
+	if p.peers == nil { //还没有设置节点
+		return nil, false
+	}
+	// p.peers.GetIf(key)：获取缓存key对应的节点，即缓存key的缓存数据应该存在哪个节点上
+	// 该节点熔断时，顺时针找下一个健康的节点，自己总是健康的
 	//peer != p.self 缓存数据没有存于当前节点上
-	if peer := p.peers.Get(key); peer != "" && peer != p.self {
+	peer := p.peers.GetIf(key, func(peer string) bool {
+		return peer == p.self || p.httpGetters[peer].health.available()
+	})
+	if peer != "" && peer != p.self {
 		p.Log("Pick peer %s", peer)
 		return p.httpGetters[peer], true
 	}
 	return nil, false
 }
 
-var _ PeerPicker = (*HTTPPool)(nil)
+// SetReplication makes each key owned by the n successive nodes on the
+// hash ring instead of one, so that losing a node doesn't leave its keys
+// cold. Every node of the pool must use the same n.
+func (p *HTTPPool) SetReplication(n int) {
+	if n < 1 {
+		n = 1
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.replication = n
+}
+
+// PickReplicas returns the owners of key other than this node. As in
+// PickPeer, owners that are tripped are skipped, and so are owners at the
+// load cap of a Bounded picker; the next node on the ring takes their
+// place.
+func (p *HTTPPool) PickReplicas(key string) (peers []PeerGetter, self bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		return nil, false
+	}
+	//和PickPeer一样用GetIf，Bounded在GetIf中跳过负载已满的节点，GetN不考虑负载。
+	//每次跳过已经选中的节点，依次取出replication个节点
+	chosen := make(map[string]bool, p.replication)
+	for len(chosen) < p.replication {
+		peer := p.peers.GetIf(key, func(peer string) bool {
+			return !chosen[peer] && (peer == p.self || p.httpGetters[peer].health.available())
+		})
+		if peer == "" {
+			break
+		}
+		chosen[peer] = true
+		if peer == p.self {
+			self = true
+		} else {
+			peers = append(peers, p.httpGetters[peer])
+		}
+	}
+	return peers, self
+}
+
+// PickPrimary returns the first owner of key on the hash ring, even if
+// it is tripped or, with a Bounded picker, at its load cap.
+func (p *HTTPPool) PickPrimary(key string) (peer PeerGetter, self bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		return nil, true
+	}
+	owners := p.peers.GetN(key, 1) //GetN不考虑负载和健康状态，所有节点看到的都一样
+	if len(owners) == 0 || owners[0] == p.self {
+		return nil, true
+	}
+	return p.httpGetters[owners[0]], false
+}
+
+// PickOwners returns the replication owners of key in ring order, nil
+// for this node, even if they are tripped or at their load cap.
+func (p *HTTPPool) PickOwners(key string) (owners []PeerGetter) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		return nil
+	}
+	for _, peer := range p.peers.GetN(key, p.replication) {
+		if peer == p.self {
+			owners = append(owners, nil)
+		} else {
+			owners = append(owners, p.httpGetters[peer])
+		}
+	}
+	return owners
+}
+
+var (
+	_ PeerPicker    = (*HTTPPool)(nil)
+	_ ReplicaPicker = (*HTTPPool)(nil)
+	_ PrimaryPicker = (*HTTPPool)(nil)
+	_ OwnerPicker   = (*HTTPPool)(nil)
+)
@@ -0,0 +1,706 @@
+package geecache
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"geecache/consistenthash"
+	"geerpc/registry"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPoolMembership(t *testing.T) {
+	p := NewCache().NewHTTPPool("http://localhost:8001")
+	if _, ok := p.PickPeer("Tom"); ok {
+		t.Fatalf("an empty pool should not pick a peer")
+	}
+
+	p.AddPeers("http://localhost:8001", "http://localhost:8002")
+	p.AddPeers("http://localhost:8002", "http://localhost:8003")
+	expect := []string{"http://localhost:8001", "http://localhost:8002", "http://localhost:8003"}
+	if !reflect.DeepEqual(p.Peers(), expect) {
+		t.Fatalf("expect peers %v, got %v", expect, p.Peers())
+	}
+
+	p.RemovePeers("http://localhost:8002", "http://localhost:8003", "http://localhost:8004")
+	for _, key := range []string{"Tom", "Jack", "Sam"} {
+		if _, ok := p.PickPeer(key); ok {
+			t.Fatalf("only self is left, %s should not go to a peer", key)
+		}
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	reg := httptest.NewServer(registry.New(0))
+	defer reg.Close()
+
+	a := NewCache().NewHTTPPool("http://10.0.0.1:8001")
+	a.Discover(reg.URL, 10*time.Millisecond)
+	if peers := a.Peers(); !reflect.DeepEqual(peers, []string{"http://10.0.0.1:8001"}) {
+		t.Fatalf("a should find itself, got %v", peers)
+	}
+
+	b := NewCache().NewHTTPPool("http://10.0.0.2:8001")
+	b.Discover(reg.URL, 10*time.Millisecond)
+	expect := []string{"http://10.0.0.1:8001", "http://10.0.0.2:8001"}
+	if peers := b.Peers(); !reflect.DeepEqual(peers, expect) {
+		t.Fatalf("b should find a and itself, got %v", peers)
+	}
+	c := NewCache().NewHTTPPool("http://10.0.0.3:8001")
+	c.Discover(reg.URL, -time.Second) //非正数的间隔使用默认值，不能让time.NewTicker panic
+	if peers := c.Peers(); len(peers) != 3 {
+		t.Fatalf("c should find all 3 nodes, got %v", peers)
+	}
+	expect = append(expect, "http://10.0.0.3:8001")
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if reflect.DeepEqual(a.Peers(), expect) {
+			return
+		}
+	}
+	t.Fatalf("a should pick up b from the registry, got %v", a.Peers())
+}
+
+func TestDiscoverHeartbeatRetry(t *testing.T) {
+	var posts int32
+	reg := registry.New(0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && atomic.AddInt32(&posts, 1) == 1 { //注册中心短暂不可用
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	NewCache().NewHTTPPool("http://10.0.0.1:8001").Discover(srv.URL, time.Hour)
+	for deadline := time.Now().Add(3 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		res, err := http.Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.Header.Get("X-Geerpc-Servers") == "http://10.0.0.1:8001" {
+			return
+		}
+	}
+	t.Fatalf("the heartbeat should be retried after a failure")
+}
+
+func TestPeerFailover(t *testing.T) {
+	peer := httptest.NewServer(NewCache().NewHTTPPool("peer"))
+	addr := peer.URL
+	p := NewCache().NewHTTPPool("http://self")
+	p.Set("http://self", addr)
+
+	var key string
+	for i := 0; key == ""; i++ { //找一个属于peer的key
+		if _, ok := p.PickPeer(strconv.Itoa(i)); ok {
+			key = strconv.Itoa(i)
+		}
+	}
+	peer.Close()
+	for i := 0; i < defaultMaxFailures; i++ {
+		getter, ok := p.PickPeer(key)
+		if !ok {
+			t.Fatalf("peer should not be tripped after %d failures", i)
+		}
+		if _, err := getter.Get("scores", key); err == nil {
+			t.Fatalf("a closed peer should fail")
+		}
+	}
+	if _, ok := p.PickPeer(key); ok || p.Healthy(addr) {
+		t.Fatalf("peer should be tripped after %d failures", defaultMaxFailures)
+	}
+
+	// 熔断超时之后只放行一个探测请求
+	p.httpGetters[addr].health.openTimeout = 0
+	if _, ok := p.PickPeer(key); !ok {
+		t.Fatalf("a tripped peer should be probed after the open timeout")
+	}
+	p.httpGetters[addr].health.openTimeout = time.Hour
+	if _, ok := p.PickPeer(key); ok {
+		t.Fatalf("only one probe should be let through")
+	}
+
+	// 健康检查成功之后恢复
+	peer = httptest.NewUnstartedServer(NewCache().NewHTTPPool("peer"))
+	peer.Listener.Close()
+	l, err := net.Listen("tcp", strings.TrimPrefix(addr, "http://"))
+	if err != nil {
+		t.Skipf("cannot listen on %s again: %v", addr, err)
+	}
+	peer.Listener = l
+	peer.Start()
+	defer peer.Close()
+	p.probePeers(time.Second)
+	if _, ok := p.PickPeer(key); !ok || !p.Healthy(addr) {
+		t.Fatalf("peer should recover after a successful health check")
+	}
+}
+
+func TestReplication(t *testing.T) {
+	var (
+		servers []*httptest.Server
+		pools   []*HTTPPool
+		groups  []*Group
+		addrs   []string
+		loads   = make([]int, 3) //每个节点从数据源加载的次数
+	)
+	for i := 0; i < 3; i++ {
+		i := i
+		c := NewCache()
+		g, _ := c.NewGroup("scores", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+			loads[i]++
+			return []byte(key), nil
+		}))
+		srv := httptest.NewUnstartedServer(nil)
+		addr := "http://" + srv.Listener.Addr().String()
+		pool := c.NewHTTPPool(addr)
+		pool.SetReplication(2)
+		g.RegisterPeers(pool)
+		srv.Config.Handler = pool
+		srv.Start()
+		defer srv.Close()
+		servers, pools, groups, addrs = append(servers, srv), append(pools, pool), append(groups, g), append(addrs, addr)
+	}
+	for _, pool := range pools {
+		pool.Set(addrs...)
+	}
+
+	// 找到不负责Tom的那个节点，Tom由另外两个节点负责
+	reader := -1
+	for i, pool := range pools {
+		peers, self := pool.PickReplicas("Tom")
+		if !self {
+			reader = i
+			if len(peers) != 2 {
+				t.Fatalf("expect 2 owners of Tom, got %d", len(peers))
+			}
+		}
+	}
+	if reader < 0 {
+		t.Fatalf("Tom should not be owned by all 3 nodes")
+	}
+
+	// 关掉一个副本，另一个副本依然可以返回Tom
+	for i := range servers {
+		if i != reader {
+			servers[i].Close()
+			break
+		}
+	}
+	// 关掉的副本熔断之后，hash环上的下一个节点（可能就是reader）会接替它，所以只读到熔断之前
+	for i := 0; i < defaultMaxFailures-1; i++ {
+		if v, err := groups[reader].Get("Tom"); err != nil || v.String() != "Tom" {
+			t.Fatalf("failed to get Tom with one owner down: %v", err)
+		}
+		groups[reader].hotCache.remove("Tom")
+	}
+	if loads[reader] != 0 {
+		t.Fatalf("a replica should serve Tom, not the reader's getter")
+	}
+}
+
+func TestRemoveTrippedOwner(t *testing.T) {
+	var (
+		pools  []*HTTPPool
+		groups []*Group
+		addrs  []string
+	)
+	for i := 0; i < 2; i++ {
+		c := NewCache()
+		g, _ := c.NewGroup("scores", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+		srv := httptest.NewUnstartedServer(nil)
+		addr := "http://" + srv.Listener.Addr().String()
+		pool := c.NewHTTPPool(addr)
+		pool.SetReplication(2)
+		g.RegisterPeers(pool)
+		srv.Config.Handler = pool
+		srv.Start()
+		defer srv.Close()
+		pools, groups, addrs = append(pools, pool), append(groups, g), append(addrs, addr)
+	}
+	for _, pool := range pools {
+		pool.Set(addrs...)
+	}
+	groups[1].Get("Tom")
+
+	// 节点0认为节点1已经熔断，删除依然要发给节点1，否则节点1恢复之后还会返回旧值
+	h := pools[0].httpGetters[addrs[1]].health
+	h.mu.Lock()
+	h.state, h.since = stateOpen, time.Now()
+	h.mu.Unlock()
+	if err := groups[0].Remove("Tom"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := groups[1].mainCache.get("Tom"); ok {
+		t.Fatalf("a tripped owner should still be asked to remove Tom")
+	}
+}
+
+func TestCompareAndSetPrimary(t *testing.T) {
+	var (
+		pools  []*HTTPPool
+		groups []*Group
+		addrs  []string
+	)
+	for i := 0; i < 2; i++ {
+		c := NewCache()
+		g, _ := c.NewGroup("scores", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+		srv := httptest.NewUnstartedServer(nil)
+		addr := "http://" + srv.Listener.Addr().String()
+		pool := c.NewHTTPPool(addr)
+		pool.SetReplication(2)
+		g.RegisterPeers(pool)
+		srv.Config.Handler = pool
+		srv.Start()
+		defer srv.Close()
+		pools, groups, addrs = append(pools, pool), append(groups, g), append(addrs, addr)
+	}
+	for _, pool := range pools {
+		pool.Set(addrs...)
+	}
+
+	// 两个节点都负责Tom，不是第一个节点的副本从第一个节点加载，版本相同
+	a, err := groups[0].Get("Tom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := groups[1].Get("Tom")
+	if err != nil || b.Version() != a.Version() {
+		t.Fatalf("expect both owners to agree on the version of Tom, got %d and %d (%v)", a.Version(), b.Version(), err)
+	}
+
+	// 两个节点同时用同一个版本比较写入，只在第一个节点上比较，只有一个成功
+	errs := make(chan error, 2)
+	for i, g := range groups {
+		g, value := g, []byte(strconv.Itoa(i))
+		go func() {
+			_, err := g.CompareAndSet("Tom", a.Version(), value)
+			errs <- err
+		}()
+	}
+	var won int
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err == nil {
+			won++
+		} else if !errors.Is(err, ErrVersionMismatch) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if won != 1 {
+		t.Fatalf("expect exactly one CompareAndSet to win, %d did", won)
+	}
+	a, _ = groups[0].Get("Tom")
+	b, _ = groups[1].Get("Tom")
+	if a.String() != b.String() || a.Version() != b.Version() {
+		t.Fatalf("owners disagree after CompareAndSet: %q@%d and %q@%d", a, a.Version(), b, b.Version())
+	}
+
+	// 副本只接受比缓存中更新的版本，返回保留的版本
+	primary, replica := groups[1], groups[0]
+	if _, self := pools[0].PickPrimary("Tom"); self {
+		primary, replica = groups[0], groups[1]
+	}
+	if kept, err := replica.setLocally(context.Background(), "Tom", []byte("old"), 1); err != nil || kept != a.Version() {
+		t.Fatalf("expect an old replica write to be refused with version %d kept, got %d %v", a.Version(), kept, err)
+	}
+	if v, _ := replica.Get("Tom"); v.String() != a.String() {
+		t.Fatalf("expect the replica to keep %q, got %q", a, v)
+	}
+
+	// 从副本写入也交给第一个节点分配版本
+	if err := replica.Set("Tom", []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	a, _ = primary.Get("Tom")
+	b, _ = replica.Get("Tom")
+	if a.String() != "new" || a.Version() != b.Version() {
+		t.Fatalf("expect both owners to have new with one version, got %q@%d and %q@%d", a, a.Version(), b, b.Version())
+	}
+
+	// 批量获取时副本同样从第一个节点加载
+	for _, key := range []string{"Jack", "Sam", "Kate"} {
+		primary, replica := groups[1], groups[0]
+		if _, self := pools[0].PickPrimary(key); self {
+			primary, replica = groups[0], groups[1]
+		}
+		r := replica.GetMany([]string{key})[0]
+		v, _ := primary.Get(key)
+		if r.Err != nil || r.Value.Version() != v.Version() {
+			t.Fatalf("expect GetMany on a replica to get %s@%d from the first owner, got @%d %v", key, v.Version(), r.Value.Version(), r.Err)
+		}
+	}
+}
+
+func TestSetFailover(t *testing.T) {
+	var (
+		servers []*httptest.Server
+		pools   []*HTTPPool
+		groups  []*Group
+		addrs   []string
+	)
+	for i := 0; i < 2; i++ {
+		c := NewCache()
+		g, _ := c.NewGroup("scores", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+		srv := httptest.NewUnstartedServer(nil)
+		addr := "http://" + srv.Listener.Addr().String()
+		pool := c.NewHTTPPool(addr)
+		pool.SetReplication(2)
+		g.RegisterPeers(pool)
+		srv.Config.Handler = pool
+		srv.Start()
+		defer srv.Close()
+		servers, pools, groups, addrs = append(servers, srv), append(pools, pool), append(groups, g), append(addrs, addr)
+	}
+	for _, pool := range pools {
+		pool.Set(addrs...)
+	}
+	primary, replica := 1, 0
+	if _, self := pools[0].PickPrimary("Tom"); self {
+		primary, replica = 0, 1
+	}
+
+	// 第一个节点不可达时由下一个节点写入，复制给第一个节点失败要报告出来
+	servers[primary].Close()
+	err := groups[replica].Set("Tom", []byte("630"))
+	if err == nil || isUnreachable(err) {
+		t.Fatalf("expect a replication error with the first owner down, got %v", err)
+	}
+	if v, ok := groups[replica].mainCache.get("Tom"); !ok || v.String() != "630" {
+		t.Fatalf("the next owner should take the write, got %q %v", v, ok)
+	}
+	if _, err := groups[replica].CompareAndSet("Tom", 0, []byte("1")); err == nil {
+		t.Fatalf("CompareAndSet should fail with the first owner down")
+	}
+}
+
+func TestSetPicker(t *testing.T) {
+	srv := httptest.NewServer(NewCache().NewHTTPPool("peer"))
+	defer srv.Close()
+	bounded := consistenthash.NewBounded(defaultReplicas, 1.25, nil)
+	p := NewCache().NewHTTPPool("http://self")
+	p.SetPicker(func() consistenthash.Picker { return bounded })
+	p.Set("http://self", srv.URL)
+
+	key := ""
+	for i := 0; key == ""; i++ {
+		if k := strconv.Itoa(i); bounded.Map.Get(k) == srv.URL {
+			key = k
+		}
+	}
+	getter, ok := p.PickPeer(key)
+	if !ok {
+		t.Fatalf("%s should go to %s", key, srv.URL)
+	}
+	getter.Get("scores", key) //没有scores分组，只关心请求结束之后负载是否归零
+	if load := bounded.Load(srv.URL); load != 0 {
+		t.Fatalf("load of %s should be 0 after the request, got %d", srv.URL, load)
+	}
+
+	// 负载达到上限之后，key交给下一个节点，Group使用的PickReplicas也一样
+	bounded.Inc(srv.URL)
+	bounded.Inc(srv.URL)
+	if _, ok := p.PickPeer(key); ok {
+		t.Fatalf("PickPeer should skip %s at its load cap", srv.URL)
+	}
+	if peers, self := p.PickReplicas(key); !self || len(peers) != 0 {
+		t.Fatalf("PickReplicas should skip %s at its load cap, got %d peers", srv.URL, len(peers))
+	}
+	bounded.Done(srv.URL)
+	bounded.Done(srv.URL)
+	if peers, self := p.PickReplicas(key); self || len(peers) != 1 {
+		t.Fatalf("%s should own %s again, got self=%v", srv.URL, key, self)
+	}
+}
+
+func TestJumpMembership(t *testing.T) {
+	peers := []string{"http://10.0.0.1:8001", "http://10.0.0.2:8001", "http://10.0.0.3:8001", "http://10.0.0.4:8001"}
+	jump := func() consistenthash.Picker { return consistenthash.NewJump(nil) }
+	a, b := NewCache().NewHTTPPool(peers[0]), NewCache().NewHTTPPool(peers[1])
+	a.SetPicker(jump)
+	b.SetPicker(jump)
+	// 同样的节点，以不同的顺序得知
+	a.Set(peers[0], peers[1])
+	a.AddPeers(peers[3])
+	a.AddPeers(peers[2])
+	b.Set(peers[3], peers[2], peers[1], peers[0])
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		if owner := a.peers.Get(key); owner != b.peers.Get(key) {
+			t.Fatalf("nodes with the same peers disagree on the owner of %s", key)
+		}
+	}
+}
+
+func TestSetWeighted(t *testing.T) {
+	p := NewCache().NewHTTPPool("http://localhost:8001")
+	p.SetWeighted(map[string]int{"http://localhost:8001": 1, "http://localhost:8002": 3})
+	expect := []string{"http://localhost:8001", "http://localhost:8002"}
+	if !reflect.DeepEqual(p.Peers(), expect) {
+		t.Fatalf("expect peers %v, got %v", expect, p.Peers())
+	}
+	picked := 0
+	for i := 0; i < 1000; i++ {
+		if _, ok := p.PickPeer("key" + strconv.Itoa(i)); ok {
+			picked++
+		}
+	}
+	// 8002的权重是8001的3倍，负责的key应该明显多于一半
+	if picked < 550 {
+		t.Errorf("the peer of weight 3 should own most of 1000 keys, got %d", picked)
+	}
+}
+
+func TestInvalidate(t *testing.T) {
+	var loads int32
+	c := NewCache()
+	gee, _ := c.NewGroup("scores", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		atomic.AddInt32(&loads, 1)
+		return []byte(key), nil
+	}))
+	srv := httptest.NewServer(c.NewHTTPPool("peer"))
+	defer srv.Close()
+	p := NewCache().NewHTTPPool("http://self")
+	p.Set("http://self", srv.URL)
+
+	keys := []string{"user:1", "user:2", "post:1"}
+	load := func() int32 {
+		before := atomic.LoadInt32(&loads)
+		for _, key := range keys {
+			gee.Get(key)
+		}
+		return atomic.LoadInt32(&loads) - before
+	}
+	// 失效消息是异步送达的，等待对方的缓存被删除
+	waitLoads := func(expect int32) {
+		t.Helper()
+		for i := 0; i < 100; i++ {
+			if gee.CacheStats(MainCache).Items == int64(len(keys))-int64(expect) {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if n := load(); n != expect {
+			t.Fatalf("expect %d keys to be reloaded, got %d", expect, n)
+		}
+	}
+	load()
+	p.Invalidate("scores", "user:1")
+	waitLoads(1)
+	p.InvalidatePrefix("scores", "user:")
+	waitLoads(2)
+	p.InvalidateGroup("scores")
+	waitLoads(3)
+
+	// 重发的消息只处理一次
+	inv := Invalidation{Origin: "http://other", Seq: 1, Kind: InvalidateGroup, Group: "scores"}
+	body, _ := json.Marshal([]Invalidation{inv})
+	http.Post(srv.URL+defaultBasePath+invalidatePath, "application/json", bytes.NewReader(body))
+	waitLoads(3)
+	http.Post(srv.URL+defaultBasePath+invalidatePath, "application/json", bytes.NewReader(body))
+	if n := load(); n != 0 {
+		t.Fatalf("a duplicate invalidation should be dropped, got %d reloads", n)
+	}
+}
+
+func TestInvalidateConcurrent(t *testing.T) {
+	c := NewCache()
+	gee, _ := c.NewGroup("scores", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	srv := httptest.NewServer(c.NewHTTPPool("peer"))
+	defer srv.Close()
+	p := NewCache().NewHTTPPool("http://self")
+	p.Set("http://self", srv.URL)
+
+	// 并发发布的消息按序号顺序进入发件箱，对方不会把序号小的当成重复消息丢掉
+	const n = 50
+	for i := 0; i < n; i++ {
+		gee.Get(strconv.Itoa(i))
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			p.Invalidate("scores", key)
+		}(strconv.Itoa(i))
+	}
+	wg.Wait()
+	for i := 0; i < 300 && gee.CacheStats(MainCache).Items > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if items := gee.CacheStats(MainCache).Items; items != 0 {
+		t.Fatalf("every invalidation should be delivered, %d keys are left", items)
+	}
+
+	// 确认时删除所有不大于确认序号的消息
+	o := &outbox{pending: []Invalidation{{Seq: 5}, {Seq: 7}, {Seq: 3}}}
+	o.ack(5)
+	if len(o.pending) != 1 || o.pending[0].Seq != 7 {
+		t.Fatalf("expect only seq 7 left after acking 5, got %+v", o.pending)
+	}
+}
+
+func TestInvalidateRetry(t *testing.T) {
+	c := NewCache()
+	gee, _ := c.NewGroup("scores", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	peer := httptest.NewServer(c.NewHTTPPool("peer"))
+	addr := peer.URL
+	peer.Close()
+	p := NewCache().NewHTTPPool("http://self")
+	p.Set("http://self", addr)
+	gee.Get("Tom")
+	p.Invalidate("scores", "Tom") //节点不可用，消息留在发件箱里重试
+
+	peer = httptest.NewUnstartedServer(c.NewHTTPPool("peer"))
+	peer.Listener.Close()
+	l, err := net.Listen("tcp", strings.TrimPrefix(addr, "http://"))
+	if err != nil {
+		t.Skipf("cannot listen on %s again: %v", addr, err)
+	}
+	peer.Listener = l
+	peer.Start()
+	defer peer.Close()
+	for i := 0; i < 300; i++ {
+		if gee.CacheStats(MainCache).Items == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("the invalidation should be delivered once the peer is back")
+}
+
+func TestPeerToken(t *testing.T) {
+	c := NewCache()
+	gee, _ := c.NewGroup("scores", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(db[key]), nil
+	}))
+	p := c.NewHTTPPool("http://owner")
+	p.SetPeerToken("secret")
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+	gee.Get("Tom")
+
+	// 没有令牌的写入、删除、失效请求都被拒绝，读取不受影响
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodDelete, srv.URL+defaultBasePath+"scores/Tom", nil),
+		httptest.NewRequest(http.MethodPut, srv.URL+defaultBasePath+"scores/Tom", strings.NewReader("1")),
+		httptest.NewRequest(http.MethodPost, srv.URL+defaultBasePath+invalidatePath, strings.NewReader("[]")),
+	} {
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, req)
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("expect 401 for %s %s without a token, got %d", req.Method, req.URL.Path, w.Code)
+		}
+	}
+	if v, _ := gee.Get("Tom"); v.String() != "630" {
+		t.Fatalf("Tom should not be changed by unauthorized requests, got %s", v)
+	}
+
+	// 设置了同样令牌的节点可以写入和删除
+	peer := NewCache().NewHTTPPool("http://self")
+	peer.SetPeerToken("secret")
+	peer.Set(srv.URL)
+	getter := peer.httpGetters[srv.URL]
+	if v, err := getter.Get("scores", "Tom"); err != nil || v.String() != "630" {
+		t.Fatalf("reads should not need a token, got %s %v", v, err)
+	}
+	if _, err := getter.Set(context.Background(), "scores", "Tom", []byte("700"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := getter.Remove("scores", "Tom"); err != nil {
+		t.Fatal(err)
+	}
+	other := NewCache().NewHTTPPool("http://other")
+	other.Set(srv.URL)
+	if err := other.httpGetters[srv.URL].Remove("scores", "Tom"); err == nil {
+		t.Fatalf("a peer without the token should not remove Tom")
+	}
+}
+
+func TestAdmin(t *testing.T) {
+	c := NewCache()
+	//主缓存13字节，只放得下Tom和Jack
+	gee, _ := c.NewGroup("scores", 14, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(db[key]), nil
+	}))
+	p := c.NewHTTPPool("http://self")
+	p.Set("http://self")
+	srv := httptest.NewServer(p)
+	defer srv.Close()
+	admin := func(method string, path string, token string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, srv.URL+defaultBasePath+adminPath+path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+	if res := admin(http.MethodGet, "groups", "secret"); res.StatusCode != http.StatusForbidden {
+		t.Fatalf("the admin API should be disabled by default, got %v", res.Status)
+	}
+	p.SetAdminAuth(BearerToken("secret"))
+	if res := admin(http.MethodGet, "groups", "wrong"); res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expect 401 with a wrong token, got %v", res.Status)
+	}
+
+	gee.Get("Tom")
+	gee.Get("Jack")
+	var groups []groupInfo
+	json.NewDecoder(admin(http.MethodGet, "groups", "secret").Body).Decode(&groups)
+	if len(groups) != 1 || groups[0].Name != "scores" || groups[0].MainCache.Items != 2 {
+		t.Fatalf("unexpected groups %+v", groups)
+	}
+
+	// 查看Tom不影响淘汰顺序，加入Sam时淘汰的依然是Tom
+	var info keyInfo
+	json.NewDecoder(admin(http.MethodGet, "groups/scores/keys/Tom", "secret").Body).Decode(&info)
+	if string(info.Value) != "630" || info.Cache != "main" || info.Version == 0 {
+		t.Fatalf("unexpected key info %+v", info)
+	}
+	gee.Get("Sam")
+	var keys []keyInfo
+	json.NewDecoder(admin(http.MethodGet, "groups/scores/keys", "secret").Body).Decode(&keys)
+	if len(keys) != 2 || keys[0].Key != "Jack" || keys[1].Key != "Sam" {
+		t.Fatalf("peeking Tom should not save it from eviction, got %+v", keys)
+	}
+
+	admin(http.MethodDelete, "groups/scores/keys/Jack", "secret")
+	if res := admin(http.MethodGet, "groups/scores/keys/Jack", "secret"); res.StatusCode != http.StatusNotFound {
+		t.Fatalf("Jack should be evicted, got %v", res.Status)
+	}
+	admin(http.MethodDelete, "groups/scores", "secret")
+	if items := gee.CacheStats(MainCache).Items; items != 0 {
+		t.Fatalf("the group should be purged, got %d items", items)
+	}
+
+	var owners []ownerInfo
+	json.NewDecoder(admin(http.MethodGet, "ring?key=Tom", "secret").Body).Decode(&owners)
+	if len(owners) != 1 || owners[0].Peer != "http://self" || !owners[0].Self {
+		t.Fatalf("unexpected owners %+v", owners)
+	}
+}
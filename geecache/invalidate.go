@@ -0,0 +1,279 @@
+/*
+ * @Description:集群范围的缓存失效广播。
+ * 任意节点都可以发布失效消息（单个key、key前缀、整个分组），本节点立刻删除，同时放进每个远程节点的发件箱，
+ * 后台按顺序批量发送，失败时退避重试，直到对方确认，保证至少送达一次。
+ * 每条消息带有发布节点和递增的序号，接收方记录每个发布节点已经处理过的最大序号，重发的消息直接丢弃
+ * @version:
+ * @Author: Steven
+ * @Date: 2023-05-06 20:12:45
+ */
+package geecache
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	invalidatePath     = "_invalidate" //POST /_geecache/_invalidate 接收其他节点发布的失效消息
+	invalidateBatch    = 100           //一次最多发送的消息条数
+	maxOutbox          = 10000         //发件箱中最多积压的消息条数，超过之后按分组合并
+	minInvalidateRetry = time.Millisecond * 100
+	maxInvalidateRetry = time.Second * 30
+	invalidateTimeout  = time.Second * 5 //节点没有响应时不能一直等待，之后的消息都会被阻塞
+)
+
+// InvalidationKind tells what an Invalidation drops.
+type InvalidationKind uint8
+
+const (
+	InvalidateKey    InvalidationKind = iota + 1 // 一个key
+	InvalidatePrefix                             // 以Key为前缀的所有key
+	InvalidateGroup                              // 整个分组
+)
+
+// An Invalidation tells every node to drop cached values of Group.
+// Origin and Seq identify it, so that a node applies it once even if it
+// is delivered more than once.
+type Invalidation struct {
+	Origin string
+	Seq    uint64
+	Kind   InvalidationKind
+	Group  string
+	Key    string `json:",omitempty"` //Kind为InvalidatePrefix时是前缀
+}
+
+// 在本节点的分组上执行失效消息，分组不存在时忽略
+func (c *Cache) invalidate(inv Invalidation) {
+	g := c.GetGroup(inv.Group)
+	if g == nil {
+		return
+	}
+	switch inv.Kind {
+	case InvalidateKey:
+		g.removeLocally(inv.Key)
+	case InvalidatePrefix:
+		g.removeFuncLocally(func(key string) bool { return strings.HasPrefix(key, inv.Key) })
+	case InvalidateGroup:
+		g.removeFuncLocally(func(string) bool { return true })
+	}
+}
+
+// 失效广播的状态，零值可用
+type invalidationBus struct {
+	mu       sync.Mutex
+	seq      uint64             //最近发布的序号
+	outboxes map[string]*outbox //每个远程节点一个发件箱
+	applied  map[string]uint64  //每个发布节点已经处理过的最大序号
+}
+
+// 发给一个远程节点的消息，按发布顺序发送
+type outbox struct {
+	mu      sync.Mutex
+	pending []Invalidation
+	wake    chan struct{} //有新消息时通知发送协程
+	stop    chan struct{} //节点离开集群时关闭，未发送的消息丢弃
+}
+
+// Invalidate drops key of group on every node of the pool. It returns
+// once the key is dropped on this node; other nodes get it in the
+// background, retrying until they acknowledge it.
+func (p *HTTPPool) Invalidate(group string, key string) {
+	p.publish(InvalidateKey, group, key)
+}
+
+// InvalidatePrefix is like Invalidate for every key of group starting
+// with prefix.
+func (p *HTTPPool) InvalidatePrefix(group string, prefix string) {
+	p.publish(InvalidatePrefix, group, prefix)
+}
+
+// InvalidateGroup is like Invalidate for every key of group.
+func (p *HTTPPool) InvalidateGroup(group string) {
+	p.publish(InvalidateGroup, group, "")
+}
+
+func (p *HTTPPool) publish(kind InvalidationKind, group string, key string) {
+	b := &p.bus
+	b.mu.Lock()
+	if b.seq == 0 { //从启动时间开始，节点重启之后的序号依然比重启之前的大，不会被对方当成重复消息
+		b.seq = uint64(time.Now().UnixNano())
+	}
+	b.seq++
+	inv := Invalidation{Origin: p.self, Seq: b.seq, Kind: kind, Group: group, Key: key}
+	for _, o := range b.outboxes { //取序号和放入发件箱在同一个临界区，发件箱里的序号总是递增的
+		o.push(inv)
+	}
+	b.mu.Unlock()
+
+	p.cache.invalidate(inv)
+}
+
+// 按当前的节点列表创建或者关闭发件箱，调用前必须持有p.mu
+func (p *HTTPPool) syncOutboxes() {
+	b := &p.bus
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.outboxes == nil {
+		b.outboxes = make(map[string]*outbox)
+	}
+	for peer, o := range b.outboxes {
+		if _, ok := p.httpGetters[peer]; !ok {
+			close(o.stop)
+			delete(b.outboxes, peer)
+		}
+	}
+	for peer := range p.httpGetters {
+		if _, ok := b.outboxes[peer]; ok || peer == p.self {
+			continue
+		}
+		o := &outbox{wake: make(chan struct{}, 1), stop: make(chan struct{})}
+		b.outboxes[peer] = o
+		go p.deliver(peer, o)
+	}
+}
+
+func (o *outbox) push(inv Invalidation) {
+	o.mu.Lock()
+	o.pending = append(o.pending, inv)
+	if len(o.pending) > maxOutbox { //节点长时间不可用，合并成整个分组的失效，宁可多删也不能漏删
+		o.pending = coalesce(o.pending)
+	}
+	o.mu.Unlock()
+	select {
+	case o.wake <- struct{}{}:
+	default: //已经通知过了
+	}
+}
+
+// 每个分组只保留一条整个分组的失效消息，序号取该分组最后一条消息的序号
+func coalesce(pending []Invalidation) []Invalidation {
+	last := make(map[string]int)
+	for i, inv := range pending {
+		last[inv.Group] = i
+	}
+	out := make([]Invalidation, 0, len(last))
+	for i, inv := range pending {
+		if last[inv.Group] == i {
+			inv.Kind, inv.Key = InvalidateGroup, ""
+			out = append(out, inv)
+		}
+	}
+	return out
+}
+
+// 取出最前面的一批消息，发送成功之后再调用ack删除
+func (o *outbox) peek() []Invalidation {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	n := len(o.pending)
+	if n > invalidateBatch {
+		n = invalidateBatch
+	}
+	return append([]Invalidation(nil), o.pending[:n]...)
+}
+
+// 删除已经送达的消息。发送期间可能合并过，按序号删除而不是按条数
+func (o *outbox) ack(seq uint64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	pending := o.pending[:0]
+	for _, inv := range o.pending {
+		if inv.Seq > seq {
+			pending = append(pending, inv)
+		}
+	}
+	o.pending = pending
+}
+
+// 发送协程：有消息时按顺序批量发送，失败时退避重试，直到节点离开集群
+func (p *HTTPPool) deliver(peer string, o *outbox) {
+	retry := minInvalidateRetry
+	for {
+		select {
+		case <-o.wake:
+		case <-o.stop:
+			return
+		}
+		for batch := o.peek(); len(batch) > 0; batch = o.peek() {
+			if err := p.sendInvalidations(peer, batch); err != nil {
+				log.Printf("[GeeCache] failed to send invalidations to %s: %v", peer, err)
+				select {
+				case <-time.After(retry):
+				case <-o.stop:
+					return
+				}
+				if retry *= 2; retry > maxInvalidateRetry {
+					retry = maxInvalidateRetry
+				}
+				continue
+			}
+			retry = minInvalidateRetry
+			o.ack(batch[len(batch)-1].Seq)
+		}
+	}
+}
+
+func (p *HTTPPool) sendInvalidations(peer string, batch []Invalidation) error {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), invalidateTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, peer+p.basePath+invalidatePath, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	setPeerToken(req, p.peerToken)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("server returned: %v", res.Status)
+	}
+	return nil
+}
+
+// 接收其他节点发布的失效消息，处理完之后返回200作为确认
+func (p *HTTPPool) serveInvalidate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var batch []Invalidation
+	if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, inv := range batch {
+		if p.bus.seen(inv) {
+			continue
+		}
+		p.cache.invalidate(inv)
+	}
+}
+
+// 同一个发布节点的消息按序号递增送达，序号不大于已处理的最大序号就是重发的消息
+func (b *invalidationBus) seen(inv Invalidation) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.applied == nil {
+		b.applied = make(map[string]uint64)
+	}
+	if inv.Seq <= b.applied[inv.Origin] {
+		return true
+	}
+	b.applied[inv.Origin] = inv.Seq
+	return false
+}
@@ -0,0 +1,197 @@
+/*
+ * @Description:LFU淘汰策略，淘汰访问次数最少的缓存，访问次数相同时淘汰最久没有访问的
+ * @version:
+ * @Author: Steven
+ * @Date: 2023-04-10 10:12:31
+ */
+package lfu
+
+import (
+	"container/heap"
+	"geecache/lru"
+	"sort"
+	"time"
+)
+
+// Value use Len to count how many bytes it takes
+type Value = lru.Value
+
+// Cache is a LFU cache. It is not safe for concurrent access.
+type Cache struct {
+	maxBytes int64             //最大可以使用的内存
+	nbytes   int64             //当前已经使用的内存
+	tick     int64             //每访问一次加1，用来记录访问的先后
+	queue    entryHeap         //按访问次数排序的小顶堆，堆顶就是下一个被淘汰的缓存
+	cache    map[string]*entry //缓存键值对map
+	// optional and executed when an entry is purged.
+	OnEvicted func(key string, value Value)
+}
+
+type entry struct {
+	key    string
+	value  Value
+	expire time.Time //过期时间，零值代表永不过期
+	freq   int64     //访问次数
+	tick   int64     //最近一次访问的时间点
+	index  int       //在堆中的下标，heap.Fix和heap.Remove需要
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.expire.IsZero() && !now.Before(e.expire)
+}
+
+// New is the Constructor of Cache
+func New(maxBytes int64, onEvicted func(string, Value)) *Cache {
+	return &Cache{
+		maxBytes:  maxBytes,
+		cache:     make(map[string]*entry),
+		OnEvicted: onEvicted,
+	}
+}
+
+// Add adds a value to the cache.
+func (c *Cache) Add(key string, value Value) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+// AddWithExpire adds a value to the cache which expires at the given time.
+// A zero expire means the value never expires.
+func (c *Cache) AddWithExpire(key string, value Value, expire time.Time) {
+	c.tick++
+	if e, ok := c.cache[key]; ok { //更新值也算一次访问
+		c.nbytes += int64(value.Len()) - int64(e.value.Len())
+		e.value = value
+		e.expire = expire
+		e.freq++
+		e.tick = c.tick
+		heap.Fix(&c.queue, e.index)
+	} else {
+		e := &entry{key: key, value: value, expire: expire, freq: 1, tick: c.tick}
+		heap.Push(&c.queue, e)
+		c.cache[key] = e
+		c.nbytes += int64(len(key)) + int64(value.Len())
+	}
+	for c.maxBytes != 0 && c.maxBytes < c.nbytes {
+		c.RemoveOldest()
+	}
+}
+
+// Get look ups a key's value
+func (c *Cache) Get(key string) (value Value, ok bool) {
+	e, ok := c.cache[key]
+	if !ok {
+		return
+	}
+	if e.expired(time.Now()) {
+		c.removeEntry(e)
+		return nil, false
+	}
+	c.tick++
+	e.freq++
+	e.tick = c.tick
+	heap.Fix(&c.queue, e.index) //访问次数变了，调整在堆中的位置
+	return e.value, true
+}
+
+// Peek returns the value of key and its expire time without updating
+// its recency or frequency, and without removing it if it has expired.
+func (c *Cache) Peek(key string) (value Value, expire time.Time, ok bool) {
+	e, ok := c.cache[key]
+	if !ok || e.expired(time.Now()) {
+		return nil, time.Time{}, false
+	}
+	return e.value, e.expire, true
+}
+
+// Remove removes the provided key from the cache.
+func (c *Cache) Remove(key string) {
+	if e, ok := c.cache[key]; ok {
+		c.removeEntry(e)
+	}
+}
+
+// RemoveOldest removes the least frequently used item
+func (c *Cache) RemoveOldest() {
+	if len(c.queue) > 0 {
+		c.removeEntry(c.queue[0])
+	}
+}
+
+// RemoveExpired removes all expired items and returns how many were removed.
+func (c *Cache) RemoveExpired() int {
+	now := time.Now()
+	n := 0
+	for _, e := range c.cache { //遍历map时删除元素是安全的
+		if e.expired(now) {
+			c.removeEntry(e)
+			n++
+		}
+	}
+	return n
+}
+
+// Walk calls fn for every unexpired item from the first to be evicted
+// to the last. fn must not modify the cache.
+func (c *Cache) Walk(fn func(key string, value Value, expire time.Time)) {
+	entries := make(entryHeap, len(c.queue)) //堆只保证堆顶最小，拷贝一份排序
+	copy(entries, c.queue)
+	sort.Slice(entries, entries.Less) //sort.Slice不调用Swap，不会改动堆中的下标
+	now := time.Now()
+	for _, e := range entries {
+		if !e.expired(now) {
+			fn(e.key, e.value, e.expire)
+		}
+	}
+}
+
+func (c *Cache) removeEntry(e *entry) {
+	heap.Remove(&c.queue, e.index)
+	delete(c.cache, e.key)
+	c.nbytes -= int64(len(e.key)) + int64(e.value.Len())
+	if c.OnEvicted != nil {
+		c.OnEvicted(e.key, e.value)
+	}
+}
+
+// Len returns the number of items in the cache.
+func (c *Cache) Len() int {
+	return len(c.queue)
+}
+
+// Bytes returns the number of bytes used by keys and values in the cache.
+func (c *Cache) Bytes() int64 {
+	return c.nbytes
+}
+
+// entryHeap implements heap.Interface, ordered by frequency then recency.
+type entryHeap []*entry
+
+func (h entryHeap) Len() int { return len(h) }
+
+func (h entryHeap) Less(i, j int) bool {
+	if h[i].freq == h[j].freq {
+		return h[i].tick < h[j].tick
+	}
+	return h[i].freq < h[j].freq
+}
+
+func (h entryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *entryHeap) Push(x interface{}) {
+	e := x.(*entry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *entryHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return e
+}
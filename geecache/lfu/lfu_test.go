@@ -0,0 +1,98 @@
+/*
+ * @Description:
+ * @version:
+ * @Author: Steven
+ * @Date: 2023-04-10 11:02:40
+ */
+package lfu
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+func TestGet(t *testing.T) {
+	lfu := New(int64(0), nil)
+	lfu.Add("key1", String("1234"))
+	if v, ok := lfu.Get("key1"); !ok || string(v.(String)) != "1234" {
+		t.Fatalf("cache hit key1=1234 failed")
+	}
+	if _, ok := lfu.Get("key2"); ok {
+		t.Fatalf("cache miss key2 failed")
+	}
+}
+
+func TestRemoveLeastFrequent(t *testing.T) {
+	k1, k2, k3 := "key1", "key2", "k3"
+	v1, v2, v3 := "value1", "value2", "v3"
+	cap := len(k1 + k2 + v1 + v2)
+	lfu := New(int64(cap), nil)
+	lfu.Add(k1, String(v1))
+	lfu.Add(k2, String(v2))
+	lfu.Get(k1) // key1 is now used more often than key2
+	lfu.Add(k3, String(v3))
+
+	if _, ok := lfu.Get(k2); ok || lfu.Len() != 2 {
+		t.Fatalf("RemoveOldest key2 failed")
+	}
+	if _, ok := lfu.Get(k1); !ok {
+		t.Fatalf("frequently used key1 should stay")
+	}
+}
+
+func TestOnEvicted(t *testing.T) {
+	keys := make([]string, 0)
+	callback := func(key string, value Value) {
+		keys = append(keys, key)
+	}
+	lfu := New(int64(10), callback)
+	lfu.Add("key1", String("123456"))
+	lfu.Add("k2", String("k2"))
+	lfu.Add("k3", String("k3"))
+	lfu.Add("k4", String("k4"))
+
+	expect := []string{"key1", "k2"}
+
+	if !reflect.DeepEqual(expect, keys) {
+		t.Fatalf("Call OnEvicted failed, expect keys equals to %s, got %s", expect, keys)
+	}
+}
+
+func TestExpire(t *testing.T) {
+	lfu := New(int64(0), nil)
+	lfu.AddWithExpire("key1", String("1234"), time.Now().Add(-time.Second))
+	lfu.AddWithExpire("key2", String("5678"), time.Now().Add(-time.Second))
+	lfu.Add("key3", String("90"))
+
+	if _, ok := lfu.Get("key1"); ok || lfu.Len() != 2 {
+		t.Fatalf("expired key1 should be a miss and removed")
+	}
+	if n := lfu.RemoveExpired(); n != 1 || lfu.Len() != 1 || lfu.Bytes() != int64(len("key390")) {
+		t.Fatalf("RemoveExpired removed %d, %d left", n, lfu.Len())
+	}
+}
+
+func TestWalk(t *testing.T) {
+	lfu := New(int64(0), nil)
+	lfu.Add("key1", String("1"))
+	lfu.Add("key2", String("2"))
+	lfu.Add("key3", String("3"))
+	lfu.Get("key1")
+	lfu.Get("key1")
+	lfu.Get("key3")
+
+	var keys []string
+	lfu.Walk(func(key string, _ Value, _ time.Time) {
+		keys = append(keys, key)
+	})
+	if expect := []string{"key2", "key3", "key1"}; !reflect.DeepEqual(keys, expect) {
+		t.Fatalf("expect %v from the least to the most frequent, got %v", expect, keys)
+	}
+}
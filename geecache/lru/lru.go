@@ -2,6 +2,7 @@ package lru
 
 import (
 	"container/list" //双向链表
+	"time"
 )
 
 // Cache is a LRU cache. It is not safe for concurrent access.
@@ -16,8 +17,14 @@ type Cache struct {
 
 // 双向链表节点的数据类型，
 type entry struct {
-	key   string //在链表中仍保存每个值对应的 key 的好处在于，淘汰队首节点时，需要用 key 从字典中删除对应的映射
-	value Value
+	key    string //在链表中仍保存每个值对应的 key 的好处在于，淘汰队首节点时，需要用 key 从字典中删除对应的映射
+	value  Value
+	expire time.Time //过期时间，零值代表永不过期
+}
+
+// expired reports whether the entry has passed its expiry time.
+func (e *entry) expired(now time.Time) bool {
+	return !e.expire.IsZero() && !now.Before(e.expire)
 }
 
 // Value use Len to count how many bytes it takes
@@ -37,6 +44,12 @@ func New(maxBytes int64, onEvicted func(string, Value)) *Cache {
 
 // Add adds a value to the cache.
 func (c *Cache) Add(key string, value Value) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+// AddWithExpire adds a value to the cache which expires at the given time.
+// A zero expire means the value never expires.
+func (c *Cache) AddWithExpire(key string, value Value, expire time.Time) {
 	if ele, ok := c.cache[key]; ok { //缓存存在
 		c.ll.MoveToFront(ele) //将该缓存移到到双向链表的队首
 		//此时ele.Value的值为&entry{key, value}，但是类型是any,即空接口
@@ -49,10 +62,11 @@ func (c *Cache) Add(key string, value Value) {
 		//后来才反应过来c.nbytes +=一个负数，那不就是c.nbytes-=这个数嘛！
 		c.nbytes += int64(value.Len()) - int64(kv.value.Len())
 		kv.value = value //将新值覆给kv.value
+		kv.expire = expire
 	} else { //缓存不存在
 		//&entry{key, value}作为值，插入到链表队首
 		//插入之后ele.Value就是&entry{key, value}
-		ele := c.ll.PushFront(&entry{key, value})
+		ele := c.ll.PushFront(&entry{key, value, expire})
 		c.cache[key] = ele
 		c.nbytes += int64(len(key)) + int64(value.Len())
 	}
@@ -64,27 +78,88 @@ func (c *Cache) Add(key string, value Value) {
 // Get look ups a key's value
 func (c *Cache) Get(key string) (value Value, ok bool) {
 	if ele, ok := c.cache[key]; ok { //从字典中找到对应的双向链表的节点
-		c.ll.MoveToFront(ele) //将链表中的节点 ele 移动到队首
 		kv := ele.Value.(*entry)
+		if kv.expired(time.Now()) { //已经过期，惰性删除，当作没有命中
+			c.removeElement(ele)
+			return nil, false
+		}
+		c.ll.MoveToFront(ele) //将链表中的节点 ele 移动到队首
 		return kv.value, true
 	}
 	return
 }
 
+// Peek returns the value of key and its expire time without updating
+// its recency or frequency, and without removing it if it has expired.
+func (c *Cache) Peek(key string) (value Value, expire time.Time, ok bool) {
+	if ele, ok := c.cache[key]; ok {
+		kv := ele.Value.(*entry)
+		if kv.expired(time.Now()) {
+			return nil, time.Time{}, false
+		}
+		return kv.value, kv.expire, true
+	}
+	return
+}
+
+// Remove removes the provided key from the cache.
+func (c *Cache) Remove(key string) {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele)
+	}
+}
+
 // RemoveOldest removes the oldest item
 func (c *Cache) RemoveOldest() {
 	ele := c.ll.Back() //返回链表队尾元素
 	if ele != nil {
-		c.ll.Remove(ele)                                       //从链表中删除该元素ele
-		kv := ele.Value.(*entry)                               //虽然从链表中删除了元素ele,但是在这列elde还是存在的，依然可以ele.Value
-		delete(c.cache, kv.key)                                //从缓存键值对c.cache中删除，key为kv.key的键值对
-		c.nbytes -= int64(len(kv.key)) + int64(kv.value.Len()) //计算淘汰该缓存之后，以使用的内存
-		if c.OnEvicted != nil {
-			c.OnEvicted(kv.key, kv.value) //删除该缓存之后，调用回调函数
+		c.removeElement(ele)
+	}
+}
+
+// RemoveExpired removes all expired items and returns how many were removed.
+func (c *Cache) RemoveExpired() int {
+	now := time.Now()
+	n := 0
+	for ele := c.ll.Back(); ele != nil; { //过期时间和访问顺序无关，只能遍历整个链表
+		prev := ele.Prev() //删除之后ele.Prev()就为nil了，需要提前保存
+		if ele.Value.(*entry).expired(now) {
+			c.removeElement(ele)
+			n++
+		}
+		ele = prev
+	}
+	return n
+}
+
+// Walk calls fn for every unexpired item from the oldest to the newest,
+// so adding them back in that order restores their recency. fn must not
+// modify the cache.
+func (c *Cache) Walk(fn func(key string, value Value, expire time.Time)) {
+	now := time.Now()
+	for ele := c.ll.Back(); ele != nil; ele = ele.Prev() { //队尾是最久没有访问的
+		if kv := ele.Value.(*entry); !kv.expired(now) {
+			fn(kv.key, kv.value, kv.expire)
 		}
 	}
 }
 
+func (c *Cache) removeElement(ele *list.Element) {
+	c.ll.Remove(ele)                                       //从链表中删除该元素ele
+	kv := ele.Value.(*entry)                               //虽然从链表中删除了元素ele,但是在这列elde还是存在的，依然可以ele.Value
+	delete(c.cache, kv.key)                                //从缓存键值对c.cache中删除，key为kv.key的键值对
+	c.nbytes -= int64(len(kv.key)) + int64(kv.value.Len()) //计算淘汰该缓存之后，以使用的内存
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value) //删除该缓存之后，调用回调函数
+	}
+}
+
+// Len returns the number of items in the cache.
 func (c *Cache) Len() int {
 	return c.ll.Len()
 }
+
+// Bytes returns the number of bytes used by keys and values in the cache.
+func (c *Cache) Bytes() int64 {
+	return c.nbytes
+}
@@ -9,6 +9,7 @@ package lru
 import (
 	"reflect"
 	"testing"
+	"time"
 )
 
 type String string
@@ -59,3 +60,64 @@ func TestOnEvicted(t *testing.T) {
 		t.Fatalf("Call OnEvicted failed, expect keys equals to %s", expect)
 	}
 }
+
+func TestExpire(t *testing.T) {
+	lru := New(int64(0), nil)
+	lru.AddWithExpire("key1", String("1234"), time.Now().Add(-time.Second))
+	lru.AddWithExpire("key2", String("5678"), time.Now().Add(time.Hour))
+	lru.Add("key3", String("90"))
+
+	if _, ok := lru.Get("key1"); ok || lru.Len() != 2 {
+		t.Fatalf("expired key1 should be a miss and removed")
+	}
+	if v, ok := lru.Get("key2"); !ok || string(v.(String)) != "5678" {
+		t.Fatalf("cache hit key2=5678 failed")
+	}
+
+	lru.AddWithExpire("key3", String("90"), time.Now().Add(-time.Second))
+	if n := lru.RemoveExpired(); n != 1 || lru.Len() != 1 {
+		t.Fatalf("RemoveExpired removed %d, %d left", n, lru.Len())
+	}
+}
+
+func TestRemove(t *testing.T) {
+	lru := New(int64(0), nil)
+	lru.Add("key1", String("1234"))
+	lru.Add("key2", String("5678"))
+	lru.Remove("key1")
+	lru.Remove("unknown")
+
+	if _, ok := lru.Get("key1"); ok || lru.Len() != 1 || lru.nbytes != int64(len("key2"+"5678")) {
+		t.Fatalf("Remove key1 failed")
+	}
+}
+
+func TestWalk(t *testing.T) {
+	lru := New(int64(0), nil)
+	lru.Add("key1", String("1"))
+	lru.Add("key2", String("2"))
+	lru.AddWithExpire("key3", String("3"), time.Now().Add(-time.Second))
+	lru.Add("key4", String("4"))
+	lru.Get("key1")
+
+	var keys []string
+	lru.Walk(func(key string, _ Value, _ time.Time) {
+		keys = append(keys, key)
+	})
+	if expect := []string{"key2", "key4", "key1"}; !reflect.DeepEqual(keys, expect) {
+		t.Fatalf("expect %v from the oldest to the newest, got %v", expect, keys)
+	}
+}
+
+func TestPeek(t *testing.T) {
+	lru := New(int64(len("key1"+"1"+"key2"+"2")), nil)
+	lru.Add("key1", String("1"))
+	lru.Add("key2", String("2"))
+	if v, _, ok := lru.Peek("key1"); !ok || string(v.(String)) != "1" {
+		t.Fatalf("cache hit key1=1 failed")
+	}
+	lru.Add("key3", String("3")) //Peek没有更新key1的位置，淘汰的依然是key1
+	if _, _, ok := lru.Peek("key1"); ok {
+		t.Fatalf("key1 should be evicted, Peek must not count as an access")
+	}
+}
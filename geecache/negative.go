@@ -0,0 +1,94 @@
+/*
+ * @Description:未找到缓存与过期缓存的后台刷新。
+ * 未找到缓存：数据源中没有的key，在一段时间内直接返回ErrNotFound，不再反复查询数据源。
+ * 后台刷新：缓存过期之后的一段时间内，依然返回过期的值，同时在后台通过singleflight只发起一次刷新，请求不用等待加载
+ * @version:
+ * @Author: Steven
+ * @Date: 2023-04-30 15:22:48
+ */
+package geecache
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+// ErrNotFound is returned, possibly wrapped, by Getters for keys that do
+// not exist in the data source. Groups with WithNegativeTTL remember it,
+// and peers pass it on instead of making the caller load the key again.
+var ErrNotFound = errors.New("geecache: not found")
+
+// 数据源中没有该key，Error()保留原始的错误信息
+type notFoundError struct {
+	msg string
+}
+
+func (e *notFoundError) Error() string { return e.msg }
+func (e *notFoundError) Unwrap() error { return ErrNotFound }
+
+const negCacheRatio = 16 //未找到缓存占用cacheBytes的1/16
+
+// WithNegativeTTL makes the group remember for ttl that a key was not
+// found, i.e. its Getter returned an error wrapping ErrNotFound, so that
+// Gets of a missing key don't hit the data source every time.
+func WithNegativeTTL(ttl time.Duration) GroupOption {
+	return func(g *Group) {
+		g.negativeTTL = ttl
+	}
+}
+
+// WithStaleWhileRevalidate keeps values for window after they expire. A
+// Get of such a stale value returns it at once and refreshes it in the
+// background, with one refresh per key at a time.
+func WithStaleWhileRevalidate(window time.Duration) GroupOption {
+	return func(g *Group) {
+		g.staleWindow = window
+	}
+}
+
+// 记录key不存在，epoch在加载之前获取，加载期间被删除过就不记录
+func (g *Group) populateNegative(key string, err error, epoch uint64) {
+	if g.negativeTTL <= 0 || !errors.Is(err, ErrNotFound) {
+		return
+	}
+	value := ByteView{b: []byte(err.Error()), e: time.Now().Add(g.negativeTTL)}
+	g.negCache.addIfEpoch(key, value, epoch)
+}
+
+// 查找未找到缓存，命中时返回包装了ErrNotFound的错误，否则返回nil
+func (g *Group) negativeHit(key string) error {
+	if g.negativeTTL <= 0 {
+		return nil
+	}
+	if v, ok := g.negCache.get(key); ok {
+		return &notFoundError{msg: v.String()}
+	}
+	return nil
+}
+
+// 发起后台刷新，一个key同时只有一个后台刷新
+func (g *Group) revalidate(key string, hot bool) {
+	if _, running := g.refreshing.LoadOrStore(key, struct{}{}); running {
+		return
+	}
+	go func() {
+		defer g.refreshing.Delete(key)
+		g.refresh(key, hot)
+	}()
+}
+
+// 后台刷新过期的缓存值，刷新和前台的加载通过singleflight合并成一次。
+// 主缓存的值由加载写回，热点缓存的值只按概率保留，所以这里要主动写回
+func (g *Group) refresh(key string, hot bool) {
+	epoch := g.hotCache.currentEpoch(key)
+	value, err := g.load(context.Background(), key)
+	if err != nil {
+		log.Printf("[GeeCache] failed to refresh %s: %v", key, err)
+		return
+	}
+	if hot {
+		g.hotCache.addIfEpoch(key, value, epoch)
+	}
+}
@@ -6,13 +6,65 @@
  */
 package geecache
 
+import "context"
+
 // PeerPicker is the interface that must be implemented to locate
 // the peer that owns a specific key.
 type PeerPicker interface {
 	PickPeer(key string) (peer PeerGetter, ok bool) //根据传入的 key 选择相应节点 PeerGetter。
 }
 
+// ReplicaPicker is implemented by PeerPickers that keep each key on more
+// than one node. peers are the owners of key other than this node, and
+// self reports whether this node is an owner too. Any owner can serve a
+// load, and removals go to all of them.
+type ReplicaPicker interface {
+	PickReplicas(key string) (peers []PeerGetter, self bool)
+}
+
+// PrimaryPicker is implemented by PeerPickers that can tell the first
+// owner of a key, whether it is healthy or not. Only the primary owner
+// gives versions to the values of a key: CompareAndSet is always checked
+// there and fails if it is down, and the other owners load the key from
+// it when they can.
+type PrimaryPicker interface {
+	PickPrimary(key string) (peer PeerGetter, self bool)
+}
+
+// OwnerPicker is implemented by PeerPickers that can tell every owner of
+// a key in ring order, whether it is healthy, at its load cap or not,
+// with nil standing for this node. Removals and replica writes go to
+// these owners, so that an owner that is down misses them only while it
+// is down, and reports it, instead of being skipped for a node that
+// doesn't own the key.
+type OwnerPicker interface {
+	PickOwners(key string) (owners []PeerGetter)
+}
+
 // PeerGetter is the interface that must be implemented by a peer.
 type PeerGetter interface { //就是一个HTTP客户端
-	Get(group string, key string) ([]byte, error) //从对应 group 查找缓存值，
+	Get(group string, key string) (ByteView, error) //从对应 group 查找缓存值，ByteView中带着剩余的有效期
+	//同Get，ctx取消或者超时时放弃请求
+	GetContext(ctx context.Context, group string, key string) (ByteView, error)
+	Remove(group string, key string) error //从对应 group 删除缓存值
+}
+
+// PeerSetter is implemented by peers that accept writes. With a version
+// of 0, Set asks the owner of key to persist value through the group's
+// Setter, cache it with a new version, which it returns, and copy it to
+// the other owners. Otherwise the peer is a replica and caches value with
+// that version unless it has a newer one, and returns the version it
+// keeps, so that the data source is written once and all owners end up
+// with the same version. CompareAndSet is Group.CompareAndSet run on the
+// primary owner.
+type PeerSetter interface {
+	Set(ctx context.Context, group string, key string, value []byte, version uint64) (uint64, error)
+	CompareAndSet(ctx context.Context, group string, key string, expected uint64, value []byte) (uint64, error)
+}
+
+// BatchPeerGetter is implemented by peers that can fetch many keys of a
+// group in one round trip. The results are in the order of keys; err is
+// set only when the whole request failed.
+type BatchPeerGetter interface {
+	GetMany(ctx context.Context, group string, keys []string) (results []Result, err error)
 }
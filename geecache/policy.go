@@ -0,0 +1,71 @@
+/*
+ * @Description:可插拔的缓存淘汰策略
+ * @version:
+ * @Author: Steven
+ * @Date: 2023-04-11 15:48:26
+ */
+package geecache
+
+import (
+	"geecache/arc"
+	"geecache/lfu"
+	"geecache/lru"
+	"geecache/tinylfu"
+	"time"
+)
+
+// Policy stores cache entries and decides which ones to evict when the
+// cache is over its byte budget. It is not safe for concurrent access;
+// cache guards it with a mutex.
+type Policy interface {
+	Get(key string) (value lru.Value, ok bool)
+	// Peek is like Get but doesn't count as an access.
+	Peek(key string) (value lru.Value, expire time.Time, ok bool)
+	AddWithExpire(key string, value lru.Value, expire time.Time)
+	Remove(key string)
+	RemoveExpired() int
+	// Walk visits every unexpired entry from the first to be evicted to
+	// the last, so that adding them back in order keeps their ranking.
+	Walk(fn func(key string, value lru.Value, expire time.Time))
+	Len() int
+	Bytes() int64
+}
+
+// PolicyType selects the eviction policy of a Group.
+type PolicyType int
+
+const (
+	LRUPolicy     PolicyType = iota // 淘汰最久没有访问的，默认策略
+	LFUPolicy                       // 淘汰访问次数最少的
+	ARCPolicy                       // 在最近访问和频繁访问之间自适应
+	TinyLFUPolicy                   // W-TinyLFU，按访问频率决定新缓存能否进入，抗扫描
+)
+
+var (
+	_ Policy = (*lru.Cache)(nil)
+	_ Policy = (*lfu.Cache)(nil)
+	_ Policy = (*arc.Cache)(nil)
+	_ Policy = (*tinylfu.Cache)(nil)
+)
+
+// 根据策略类型创建底层缓存
+func newPolicy(t PolicyType, maxBytes int64, onEvicted func(string, lru.Value)) Policy {
+	switch t {
+	case LFUPolicy:
+		return lfu.New(maxBytes, onEvicted)
+	case ARCPolicy:
+		return arc.New(maxBytes, onEvicted)
+	case TinyLFUPolicy:
+		return tinylfu.New(maxBytes, onEvicted)
+	default:
+		return lru.New(maxBytes, onEvicted)
+	}
+}
+
+// WithPolicy sets the eviction policy used by the group's caches.
+// The default is LRUPolicy.
+func WithPolicy(t PolicyType) GroupOption {
+	return func(g *Group) {
+		g.policy = t
+	}
+}
@@ -0,0 +1,79 @@
+package geecache
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+	"time"
+)
+
+var policies = []struct {
+	name string
+	t    PolicyType
+}{
+	{"LRU", LRUPolicy},
+	{"LFU", LFUPolicy},
+	{"ARC", ARCPolicy},
+	{"TinyLFU", TinyLFUPolicy},
+}
+
+// scanWorkload mixes lookups of a skewed hot set with long one-off scans,
+// the kind of traffic that flushes an LRU.
+func scanWorkload(n int) []string {
+	r := rand.New(rand.NewSource(1))
+	zipf := rand.NewZipf(r, 1.1, 1, 9999)
+	keys := make([]string, 0, n)
+	for i := 0; len(keys) < n; i++ {
+		if i%1000 < 300 {
+			keys = append(keys, "scan"+strconv.Itoa(i))
+		} else {
+			keys = append(keys, "hot"+strconv.FormatUint(zipf.Uint64(), 10))
+		}
+	}
+	return keys
+}
+
+// 模拟缓存：命中则返回，未命中则写入，返回命中率
+func hitRatio(p Policy, keys []string) float64 {
+	hits := 0
+	for _, key := range keys {
+		if _, ok := p.Get(key); ok {
+			hits++
+		} else {
+			p.AddWithExpire(key, ByteView{b: []byte("v")}, time.Time{})
+		}
+	}
+	return float64(hits) / float64(len(keys))
+}
+
+func TestPolicyScanResistance(t *testing.T) {
+	keys := scanWorkload(200000)
+	lru := hitRatio(newPolicy(LRUPolicy, 4<<10, nil), keys)
+	for _, p := range policies[1:] {
+		if ratio := hitRatio(newPolicy(p.t, 4<<10, nil), keys); ratio <= lru {
+			t.Errorf("%s hit ratio %.3f should beat LRU %.3f on a scan-heavy workload", p.name, ratio, lru)
+		} else {
+			t.Logf("%s hit ratio %.3f, LRU %.3f", p.name, ratio, lru)
+		}
+	}
+}
+
+func BenchmarkPolicies(b *testing.B) {
+	keys := scanWorkload(1 << 16)
+	for _, p := range policies {
+		b.Run(p.name, func(b *testing.B) {
+			cache := newPolicy(p.t, 4<<10, nil)
+			hits := 0
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				key := keys[i%len(keys)]
+				if _, ok := cache.Get(key); ok {
+					hits++
+				} else {
+					cache.AddWithExpire(key, ByteView{b: []byte("v")}, time.Time{})
+				}
+			}
+			b.ReportMetric(float64(hits)/float64(b.N), "hits/op")
+		})
+	}
+}
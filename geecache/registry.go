@@ -0,0 +1,119 @@
+/*
+ * @Description:缓存实例，管理一组缓存分组。
+ * 包级别的NewGroup、GetGroup、NewHTTPPool、NewRPCPool使用默认实例，
+ * 需要在同一个进程中运行多个互不影响的缓存时（比如测试），各自创建一个实例
+ * @version:
+ * @Author: Steven
+ * @Date: 2023-04-19 22:31:04
+ */
+package geecache
+
+import (
+	"errors"
+	"geerpc"
+	"log"
+	"sort"
+	"sync"
+)
+
+// A Cache owns a set of uniquely named groups and the HTTPPools or
+// RPCPools that serve them.
+type Cache struct {
+	mu     sync.RWMutex
+	groups map[string]*Group //保存着每一个缓存分组名到具体缓存Group结构体实例的映射
+}
+
+// NewCache creates an empty Cache.
+func NewCache() *Cache {
+	return &Cache{groups: make(map[string]*Group)}
+}
+
+var defaultCache = NewCache()
+
+// NewGroup creates a new group in c. See the package level NewGroup for
+// the arguments. It fails if getter is nil or the name is taken.
+func (c *Cache) NewGroup(name string, cacheBytes int64, getter Getter, opts ...GroupOption) (*Group, error) {
+	return c.register(name, cacheBytes, getter, false, opts)
+}
+
+// 创建并注册分组，replace为true时先关闭同名的分组再覆盖，和最初包级别的NewGroup一致。
+// 打开磁盘、恢复快照不持有c.mu，不会阻塞其他分组的查找
+func (c *Cache) register(name string, cacheBytes int64, getter Getter, replace bool, opts []GroupOption) (*Group, error) {
+	if getter == nil {
+		return nil, errors.New("geecache: nil Getter")
+	}
+	c.mu.Lock()
+	old, dup := c.groups[name]
+	if dup && !replace {
+		c.mu.Unlock()
+		return nil, errDuplicateGroup(name)
+	}
+	delete(c.groups, name)
+	c.mu.Unlock()
+	if dup { //旧分组的后台任务、快照和磁盘文件会和新分组冲突，先关闭
+		log.Printf("[GeeCache] replacing group %s", name)
+		if err := old.Close(); err != nil {
+			log.Printf("[GeeCache] group %s failed to close: %v", name, err)
+		}
+	}
+
+	g := newGroup(name, cacheBytes, getter, opts...)
+	if err := g.start(); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	if _, dup := c.groups[name]; dup && !replace { //期间有同名的分组注册成功了
+		c.mu.Unlock()
+		g.Close()
+		return nil, errDuplicateGroup(name)
+	}
+	old = c.groups[name]
+	c.groups[name] = g
+	c.mu.Unlock()
+	if old != nil {
+		old.Close()
+	}
+	return g, nil
+}
+
+func errDuplicateGroup(name string) error {
+	return errors.New("geecache: group already defined: " + name)
+}
+
+// GetGroup returns the named group previously created with c.NewGroup,
+// or nil if there's no such group.
+func (c *Cache) GetGroup(name string) *Group {
+	c.mu.RLock()
+	g := c.groups[name]
+	c.mu.RUnlock()
+	return g
+}
+
+// Groups returns all groups of c sorted by name.
+func (c *Cache) Groups() []*Group {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	gs := make([]*Group, 0, len(c.groups))
+	for _, g := range c.groups {
+		gs = append(gs, g)
+	}
+	sort.Slice(gs, func(i, j int) bool { return gs[i].name < gs[j].name })
+	return gs
+}
+
+// NewHTTPPool initializes an HTTP pool of peers serving the groups of c.
+func (c *Cache) NewHTTPPool(self string) *HTTPPool {
+	return &HTTPPool{
+		self:        self,
+		basePath:    defaultBasePath,
+		cache:       c,
+		replication: 1,
+	}
+}
+
+// NewRPCPool initializes a geerpc pool of peers serving the groups of c.
+// self is the geerpc address of this node, and opt is used to dial the
+// peers (geerpc.DefaultOption if nil).
+func (c *Cache) NewRPCPool(self string, opt *geerpc.Option) *RPCPool {
+	return &RPCPool{self: self, cache: c, opt: opt}
+}
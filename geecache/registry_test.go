@@ -0,0 +1,73 @@
+package geecache
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCacheIsolation(t *testing.T) {
+	newGetter := func(v string) Getter {
+		return GetterFunc(func(key string) ([]byte, error) {
+			return []byte(v), nil
+		})
+	}
+	c1, c2 := NewCache(), NewCache()
+	if _, err := c1.NewGroup("scores", 2<<10, newGetter("c1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c2.NewGroup("scores", 2<<10, newGetter("c2")); err != nil {
+		t.Fatalf("the same name in another Cache should not collide: %v", err)
+	}
+	if _, err := c1.NewGroup("scores", 2<<10, newGetter("dup")); err == nil {
+		t.Fatalf("a duplicate group name should be an error")
+	}
+	if _, err := c1.NewGroup("nil", 2<<10, nil); err == nil {
+		t.Fatalf("a nil Getter should be an error")
+	}
+
+	for want, c := range map[string]*Cache{"c1": c1, "c2": c2} {
+		srv := httptest.NewServer(c.NewHTTPPool("self"))
+		view, err := (&httpGetter{baseURL: srv.URL + defaultBasePath}).Get("scores", "Tom")
+		srv.Close()
+		if err != nil || view.String() != want {
+			t.Fatalf("pool of %s should serve its own group, got %q %v", want, view, err)
+		}
+	}
+	if gs := c1.Groups(); len(gs) != 1 || gs[0] != c1.GetGroup("scores") {
+		t.Fatalf("unexpected groups %v", gs)
+	}
+}
+
+func TestNewGroupDuplicate(t *testing.T) {
+	getter := func(v string) Getter {
+		return GetterFunc(func(key string) ([]byte, error) { return []byte(v), nil })
+	}
+	var written sync.Map
+	old := NewGroup("duplicate", 2<<10, getter("old"), WithDiskTier(t.TempDir(), 0),
+		WithWriteBehind(SetterFunc(func(ctx context.Context, key string, value []byte) error {
+			written.Store(key, string(value))
+			return nil
+		}), time.Hour, 0))
+	old.Set("Tom", []byte("630"))
+	g := NewGroup("duplicate", 2<<10, getter("new")) //包级别的NewGroup先关闭再覆盖同名分组
+	if GetGroup("duplicate") != g {
+		t.Fatalf("NewGroup should replace a group with the same name")
+	}
+	if v, err := g.Get("Tom"); err != nil || v.String() != "new" {
+		t.Fatalf("expect the new getter, got %s %v", v, err)
+	}
+	select {
+	case <-old.stop:
+	default:
+		t.Fatalf("the replaced group should be closed")
+	}
+	if v, ok := written.Load("Tom"); !ok || v != "630" {
+		t.Fatalf("the replaced group should flush its write-behind queue, got %v", v)
+	}
+	if err := old.disk.Put("Jack", nil, time.Time{}, 1); err == nil {
+		t.Fatalf("the disk tier of the replaced group should be closed")
+	}
+}
@@ -0,0 +1,432 @@
+/*
+ * @Description:基于geerpc的节点通信。
+ * 每个节点在自己的geerpc服务端上注册Cache服务，其他节点通过XClient调用，
+ * 复用geerpc的长连接和多路复用，编解码方式（gob/json）由geerpc.Option决定，
+ * 节点地址是geerpc的地址，例如tcp@10.0.0.2:9999，可以通过geerpc的注册中心发现
+ * @version:
+ * @Author: Steven
+ * @Date: 2023-05-10 21:26:08
+ */
+package geecache
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"geecache/consistenthash"
+	"geecache/wire"
+	"geerpc"
+	"geerpc/xclient"
+	"log"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errUnauthorized = errors.New("geecache: unauthorized")
+
+const (
+	rpcServiceName   = "Cache"         //在geerpc服务端上注册的服务名
+	rpcCancelTimeout = 5 * time.Second //通知节点取消请求的超时时间
+)
+
+// RPCPool implements PeerPicker for a pool of geerpc peers, addressed as
+// "protocol@addr", e.g. "tcp@10.0.0.2:9999". Each peer serves the Cache
+// service that RPCPool.Register adds to its geerpc server.
+//
+// Unlike HTTPPool, an RPCPool keeps each key on one node on a plain
+// consistent hash ring: it has no SetReplication, SetPicker or
+// SetWeighted, and doesn't implement ReplicaPicker. Use an HTTPPool for
+// those.
+type RPCPool struct {
+	self  string         //自己的geerpc地址
+	cache *Cache         //从该缓存实例中查找分组
+	opt   *geerpc.Option //连接其他节点时的协商信息，nil代表geerpc.DefaultOption
+	token string         //节点之间写入、删除请求的令牌，为空时不鉴权
+
+	mu         sync.Mutex // guards peers and rpcGetters
+	peers      consistenthash.Picker
+	rpcGetters map[string]*rpcGetter
+}
+
+// NewRPCPool initializes a geerpc pool of peers serving the groups of the
+// default Cache.
+func NewRPCPool(self string, opt *geerpc.Option) *RPCPool {
+	return defaultCache.NewRPCPool(self, opt)
+}
+
+// Log info with server name
+func (p *RPCPool) Log(format string, v ...interface{}) {
+	log.Printf("[Server %s] %s", p.self, fmt.Sprintf(format, v...))
+}
+
+// Register adds the Cache service serving the groups of the pool's cache
+// to server, so that the peers of the pool can fetch from this node.
+func (p *RPCPool) Register(server *geerpc.Server) error {
+	return server.RegisterName(rpcServiceName, &cacheService{cache: p.cache, token: p.token})
+}
+
+// SetPeerToken is HTTPPool.SetPeerToken for geerpc peers: the Set and
+// Remove calls must carry token, which the pool sends with its own. It
+// must be called before Register and Set.
+func (p *RPCPool) SetPeerToken(token string) {
+	p.token = token
+}
+
+// Set updates the pool's list of peers.
+func (p *RPCPool) Set(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, getter := range p.rpcGetters {
+		getter.xc.Close()
+	}
+	p.peers = consistenthash.New(defaultReplicas, nil)
+	p.peers.Add(peers...)
+	p.rpcGetters = make(map[string]*rpcGetter, len(peers))
+	for _, peer := range peers {
+		p.rpcGetters[peer] = p.newGetter(peer)
+	}
+}
+
+// AddPeers adds peers to the pool. Keys owned by other peers stay put.
+func (p *RPCPool) AddPeers(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		p.peers = consistenthash.New(defaultReplicas, nil)
+		p.rpcGetters = make(map[string]*rpcGetter, len(peers))
+	}
+	var added []string
+	for _, peer := range peers {
+		if _, ok := p.rpcGetters[peer]; ok {
+			continue
+		}
+		p.rpcGetters[peer] = p.newGetter(peer)
+		added = append(added, peer)
+	}
+	p.peers.Add(added...)
+}
+
+// RemovePeers removes peers from the pool and closes their connections.
+func (p *RPCPool) RemovePeers(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		return
+	}
+	var removed []string
+	for _, peer := range peers {
+		getter, ok := p.rpcGetters[peer]
+		if !ok {
+			continue
+		}
+		getter.xc.Close()
+		delete(p.rpcGetters, peer)
+		removed = append(removed, peer)
+	}
+	p.peers.Remove(removed...)
+}
+
+// Peers returns the sorted list of peers in the pool.
+func (p *RPCPool) Peers() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	peers := make([]string, 0, len(p.rpcGetters))
+	for peer := range p.rpcGetters {
+		peers = append(peers, peer)
+	}
+	sort.Strings(peers)
+	return peers
+}
+
+// Discover is like HTTPPool.Discover, using only geerpc addresses
+// ("protocol@addr") found in the registry as peers.
+func (p *RPCPool) Discover(registryAddr string, refresh time.Duration) {
+	discover(p, p.self, registryAddr, refresh, func(addr string) bool {
+		return strings.Contains(addr, "@")
+	})
+}
+
+// PickPeer picks a peer according to key, skipping tripped peers.
+func (p *RPCPool) PickPeer(key string) (PeerGetter, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		return nil, false
+	}
+	peer := p.peers.GetIf(key, func(peer string) bool {
+		return peer == p.self || p.rpcGetters[peer].health.available()
+	})
+	if peer != "" && peer != p.self {
+		p.Log("Pick peer %s", peer)
+		return p.rpcGetters[peer], true
+	}
+	return nil, false
+}
+
+// PickPrimary returns the owner of key, even if it is tripped.
+func (p *RPCPool) PickPrimary(key string) (peer PeerGetter, self bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		return nil, true
+	}
+	owner := p.peers.Get(key)
+	if owner == "" || owner == p.self {
+		return nil, true
+	}
+	return p.rpcGetters[owner], false
+}
+
+// 每个节点一个XClient，服务发现里只有这一个节点，XClient负责缓存连接，连接不可用时重新拨号
+func (p *RPCPool) newGetter(peer string) *rpcGetter {
+	d := xclient.NewMultiServerDiscovery([]string{peer})
+	return &rpcGetter{
+		peer:   peer,
+		xc:     xclient.NewXClient(d, xclient.RandomSelect, p.opt),
+		health: newPeerHealth(),
+		token:  p.token,
+	}
+}
+
+// PickOwners returns the owner of key, nil for this node, even if it is
+// tripped.
+func (p *RPCPool) PickOwners(key string) (owners []PeerGetter) {
+	peer, self := p.PickPrimary(key)
+	if self {
+		return []PeerGetter{nil}
+	}
+	return []PeerGetter{peer}
+}
+
+var (
+	_ PeerPicker    = (*RPCPool)(nil)
+	_ PrimaryPicker = (*RPCPool)(nil)
+	_ OwnerPicker   = (*RPCPool)(nil)
+)
+
+// 调用远程节点的Cache服务
+type rpcGetter struct {
+	peer   string
+	xc     *xclient.XClient
+	health *peerHealth
+	token  string //写入、删除请求带上的令牌
+}
+
+func (h *rpcGetter) Get(group string, key string) (ByteView, error) {
+	return h.GetContext(context.Background(), group, key)
+}
+
+func (h *rpcGetter) GetContext(ctx context.Context, group string, key string) (ByteView, error) {
+	var res wire.Response
+	if err := h.call(ctx, "Get", &wire.Request{Group: group, Key: key}, &res); err != nil {
+		return ByteView{}, err
+	}
+	return viewOf(&res)
+}
+
+// GetMany fetches many keys of group in one call.
+func (h *rpcGetter) GetMany(ctx context.Context, group string, keys []string) ([]Result, error) {
+	var res wire.BatchResponse
+	if err := h.call(ctx, "GetMany", &wire.Request{Group: group, Keys: keys}, &res); err != nil {
+		return nil, err
+	}
+	results := make([]Result, len(res.Items))
+	for i := range res.Items {
+		results[i].Key = res.Items[i].Key
+		results[i].Value, results[i].Err = viewOf(&res.Items[i])
+	}
+	return results, nil
+}
+
+// 调用节点的加载方法。geerpc不会把ctx传给服务端，请求里带上ctx剩余的时间和请求编号，
+// ctx结束时再用请求编号通知节点取消，节点不再为没人等待的请求加载
+func (h *rpcGetter) call(ctx context.Context, method string, req *wire.Request, reply interface{}) error {
+	req.ID, req.Timeout = rand.Uint64()|1, timeoutOf(ctx) //随机编号，不同请求方的编号不会重复
+	err := h.xc.Call(ctx, rpcServiceName+"."+method, req, reply)
+	if err != nil && ctx.Err() != nil {
+		go h.cancel(req.ID)
+	}
+	h.health.record(ctx, err)
+	return err
+}
+
+// 通知节点取消请求，节点不支持取消或者请求已经结束时什么都不做
+func (h *rpcGetter) cancel(id uint64) {
+	ctx, cancel := context.WithTimeout(context.Background(), rpcCancelTimeout)
+	defer cancel()
+	var ok bool
+	h.xc.Call(ctx, rpcServiceName+".Cancel", &wire.Request{ID: id}, &ok)
+}
+
+func (h *rpcGetter) Remove(group string, key string) error {
+	var ok bool
+	ctx := context.Background()
+	err := h.xc.Call(ctx, rpcServiceName+".Remove", &wire.Request{Group: group, Key: key, Token: h.token}, &ok)
+	h.health.record(ctx, err)
+	return err
+}
+
+func (h *rpcGetter) Set(ctx context.Context, group string, key string, value []byte, version uint64) (uint64, error) {
+	return h.set(ctx, SetRequest{Group: group, Key: key, Value: value, Version: version})
+}
+
+func (h *rpcGetter) CompareAndSet(ctx context.Context, group string, key string, expected uint64, value []byte) (uint64, error) {
+	return h.set(ctx, SetRequest{Group: group, Key: key, Value: value, Expected: expected, CompareAndSet: true})
+}
+
+func (h *rpcGetter) set(ctx context.Context, req SetRequest) (uint64, error) {
+	var version uint64
+	req.Timeout, req.Token = timeoutOf(ctx), h.token
+	err := h.xc.Call(ctx, rpcServiceName+".Set", &req, &version)
+	var se geerpc.ServerError
+	if errors.As(err, &se) { //节点正常应答了，错误经过geerpc之后只剩下字符串
+		h.health.record(ctx, nil)
+		if string(se) == ErrVersionMismatch.Error() {
+			return 0, ErrVersionMismatch
+		}
+		return 0, err
+	}
+	h.health.record(ctx, err)
+	if err != nil {
+		return 0, unreachableError{err}
+	}
+	return version, nil
+}
+
+// ctx剩余的时间，服务端按它超时
+func timeoutOf(ctx context.Context) time.Duration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0
+	}
+	if timeout := time.Until(deadline); timeout > 0 {
+		return timeout
+	}
+	return time.Nanosecond //已经超时，0代表不限制，不能用0
+}
+
+// 服务端按请求方剩余的时间构造ctx
+func contextOf(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(context.Background(), timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+var _ PeerGetter = (*rpcGetter)(nil)
+var _ BatchPeerGetter = (*rpcGetter)(nil)
+var _ PeerSetter = (*rpcGetter)(nil)
+
+// SetRequest is the argument of the Cache.Set RPC. Version is set when
+// the owner of Key copies Value to a replica; Expected is the version
+// checked by a CompareAndSet. Timeout is how long the caller still waits,
+// 0 for no limit, and Token is the pool's peer token.
+type SetRequest struct {
+	Group         string
+	Key           string
+	Value         []byte
+	Version       uint64
+	Expected      uint64
+	CompareAndSet bool
+	Timeout       time.Duration
+	Token         string
+}
+
+// 注册到geerpc服务端的Cache服务，方法的格式由geerpc约定
+type cacheService struct {
+	cache *Cache
+	token string //写入、删除请求必须带上的令牌，为空时不鉴权
+
+	mu    sync.Mutex                    // guards calls
+	calls map[uint64]context.CancelFunc //正在处理的请求，请求方放弃等待时通过Cancel取消
+}
+
+// 开始处理一个请求，返回请求的ctx，处理完之后调用done
+func (s *cacheService) begin(req *wire.Request) (ctx context.Context, done func()) {
+	ctx, cancel := contextOf(req.Timeout)
+	if req.ID == 0 { //老节点发来的请求没有编号
+		return ctx, cancel
+	}
+	s.mu.Lock()
+	if s.calls == nil {
+		s.calls = make(map[uint64]context.CancelFunc)
+	}
+	s.calls[req.ID] = cancel
+	s.mu.Unlock()
+	return ctx, func() {
+		s.mu.Lock()
+		delete(s.calls, req.ID)
+		s.mu.Unlock()
+		cancel()
+	}
+}
+
+func (s *cacheService) Get(req wire.Request, res *wire.Response) error {
+	ctx, done := s.begin(&req) //请求方不再等待时不再继续加载
+	defer done()
+	*res = *s.cache.get(ctx, req.Group, req.Key)
+	return nil
+}
+
+func (s *cacheService) GetMany(req wire.Request, res *wire.BatchResponse) error {
+	ctx, done := s.begin(&req)
+	defer done()
+	*res = *s.cache.getMany(ctx, req.Group, req.Keys)
+	return nil
+}
+
+// Cancel取消编号为req.ID的请求，取消的请求在Cancel之后才到达时依然会处理完
+func (s *cacheService) Cancel(req wire.Request, ok *bool) error {
+	s.mu.Lock()
+	cancel, found := s.calls[req.ID]
+	s.mu.Unlock()
+	if found {
+		cancel()
+	}
+	*ok = found
+	return nil
+}
+
+// 检查写入、删除请求的令牌
+func (s *cacheService) authorize(token string) error {
+	if s.token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+		return errUnauthorized
+	}
+	return nil
+}
+
+func (s *cacheService) Remove(req wire.Request, ok *bool) error {
+	if err := s.authorize(req.Token); err != nil {
+		return err
+	}
+	group := s.cache.GetGroup(req.Group)
+	if group == nil {
+		return errors.New("no such group: " + req.Group)
+	}
+	group.removeLocally(req.Key)
+	*ok = true
+	return nil
+}
+
+func (s *cacheService) Set(req SetRequest, version *uint64) error {
+	if err := s.authorize(req.Token); err != nil {
+		return err
+	}
+	group := s.cache.GetGroup(req.Group)
+	if group == nil {
+		return errors.New("no such group: " + req.Group)
+	}
+	ctx, cancel := contextOf(req.Timeout)
+	defer cancel()
+	var err error
+	if req.CompareAndSet {
+		*version, err = group.compareAndSetLocally(ctx, req.Key, req.Expected, req.Value)
+	} else {
+		*version, err = group.setLocally(ctx, req.Key, req.Value, req.Version)
+	}
+	return err
+}
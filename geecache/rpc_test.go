@@ -0,0 +1,178 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"geerpc"
+	"geerpc/codec"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// 启动一个只有Cache服务的geerpc服务端，返回它的地址
+func startRPCPeer(t *testing.T, c *Cache) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	server := geerpc.NewServer()
+	addr := "tcp@" + l.Addr().String()
+	if err := c.NewRPCPool(addr, nil).Register(server); err != nil {
+		t.Fatal(err)
+	}
+	go server.Accept(l)
+	return addr
+}
+
+func TestRPCPool(t *testing.T) {
+	for _, ct := range []codec.Type{codec.GobType, codec.JsonType} {
+		t.Run(string(ct), func(t *testing.T) {
+			loads := 0
+			owner := NewCache()
+			owner.NewGroup("scores", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+				loads++
+				if v, ok := db[key]; ok {
+					return []byte(v), nil
+				}
+				return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+			}))
+			addr := startRPCPeer(t, owner)
+
+			c := NewCache()
+			gee, _ := c.NewGroup("scores", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+				t.Fatalf("%s should be loaded by the owner", key)
+				return nil, nil
+			}))
+			p := c.NewRPCPool("tcp@self", &geerpc.Option{CodecType: ct})
+			p.Set(addr) //所有的key都属于owner
+			gee.RegisterPeers(p)
+
+			if v, err := gee.Get("Tom"); err != nil || v.String() != "630" || v.Version() == 0 {
+				t.Fatalf("expect 630 with a version from the owner, got %s %d %v", v, v.Version(), err)
+			}
+			if _, err := gee.Get("unknown"); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("expect ErrNotFound from the owner, got %v", err)
+			}
+			results := gee.GetMany([]string{"Jack", "Sam"})
+			if results[0].Value.String() != "589" || results[1].Value.String() != "567" {
+				t.Fatalf("unexpected results %+v", results)
+			}
+
+			v, _ := gee.Get("Tom")
+			version, err := gee.CompareAndSet("Tom", v.Version(), []byte("700"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := gee.CompareAndSet("Tom", v.Version(), []byte("800")); !errors.Is(err, ErrVersionMismatch) {
+				t.Fatalf("expect ErrVersionMismatch from the owner, got %v", err)
+			}
+			if v, _ := owner.GetGroup("scores").Get("Tom"); v.String() != "700" || v.Version() != version {
+				t.Fatalf("expect 700 with version %d on the owner, got %s %d", version, v, v.Version())
+			}
+			if err := gee.Remove("Tom"); err != nil {
+				t.Fatal(err)
+			}
+			before := loads
+			owner.GetGroup("scores").Get("Tom")
+			if loads != before+1 {
+				t.Fatalf("Tom should be removed from the owner")
+			}
+		})
+	}
+}
+
+func TestRPCPoolTimeout(t *testing.T) {
+	canceled := make(chan struct{})
+	owner := NewCache()
+	owner.NewGroup("scores", 2<<10, GetterContextFunc(func(ctx context.Context, key string) ([]byte, error) {
+		<-ctx.Done() //一直等到请求方不再等待
+		close(canceled)
+		return nil, ctx.Err()
+	}))
+	addr := startRPCPeer(t, owner)
+
+	c := NewCache()
+	gee, _ := c.NewGroup("scores", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return nil, ErrNotFound
+	}))
+	p := c.NewRPCPool("tcp@self", nil)
+	p.Set(addr)
+	gee.RegisterPeers(p)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	gee.GetContext(ctx, "Tom")
+	select {
+	case <-canceled:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("the owner should stop loading once the caller's deadline passes")
+	}
+}
+
+func TestRPCPeerToken(t *testing.T) {
+	owner := NewCache()
+	owner.NewGroup("scores", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(db[key]), nil
+	}))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	server := geerpc.NewServer()
+	addr := "tcp@" + l.Addr().String()
+	pool := owner.NewRPCPool(addr, nil)
+	pool.SetPeerToken("secret")
+	if err := pool.Register(server); err != nil {
+		t.Fatal(err)
+	}
+	go server.Accept(l)
+
+	for _, token := range []string{"", "wrong"} {
+		p := NewCache().NewRPCPool("tcp@self", nil)
+		p.SetPeerToken(token)
+		p.Set(addr)
+		getter := p.rpcGetters[addr]
+		if v, err := getter.Get("scores", "Tom"); err != nil || v.String() != "630" {
+			t.Fatalf("reads should not need a token, got %s %v", v, err)
+		}
+		if err := getter.Remove("scores", "Tom"); err == nil {
+			t.Fatalf("Remove with token %q should be refused", token)
+		}
+		if _, err := getter.Set(context.Background(), "scores", "Tom", []byte("1"), 0); err == nil {
+			t.Fatalf("Set with token %q should be refused", token)
+		}
+	}
+	p := NewCache().NewRPCPool("tcp@self", nil)
+	p.SetPeerToken("secret")
+	p.Set(addr)
+	if _, err := p.rpcGetters[addr].Set(context.Background(), "scores", "Tom", []byte("700"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := owner.GetGroup("scores").Get("Tom"); v.String() != "700" {
+		t.Fatalf("expect 700 after an authorized Set, got %s", v)
+	}
+}
+
+func TestRPCPoolPickPeer(t *testing.T) {
+	p := NewCache().NewRPCPool("tcp@self", nil)
+	p.Set("tcp@self", "tcp@peer")
+	picked := 0
+	for i := 0; i < 100; i++ {
+		if _, ok := p.PickPeer(strconv.Itoa(i)); ok {
+			picked++
+		}
+	}
+	if picked == 0 || picked == 100 {
+		t.Fatalf("keys should be spread over self and the peer, picked the peer %d times", picked)
+	}
+	p.RemovePeers("tcp@peer")
+	if _, ok := p.PickPeer("1"); ok {
+		t.Fatalf("no peer should be picked after the peer is removed")
+	}
+}
@@ -0,0 +1,134 @@
+/*
+ * @Description:分片缓存，按key的哈希值把缓存分散到多个分片上，每个分片有自己的锁和内存限制，
+ * 减少并发读写时对同一把锁的争抢
+ * @version:
+ * @Author: Steven
+ * @Date: 2023-04-13 20:15:36
+ */
+package geecache
+
+import (
+	"geecache/disk"
+	"time"
+)
+
+type shardedCache struct {
+	shards []*cache
+}
+
+// 创建n个分片，cacheBytes平均分给每个分片，n<=1时只有一个分片，等同于不分片
+func newShardedCache(n int, cacheBytes int64, policy PolicyType) shardedCache {
+	if n < 1 {
+		n = 1
+	}
+	shardBytes := cacheBytes / int64(n)
+	if cacheBytes > 0 && shardBytes == 0 { //0代表不限制内存，分片太多时每个分片至少1字节
+		shardBytes = 1
+	}
+	c := shardedCache{shards: make([]*cache, n)}
+	for i := range c.shards {
+		c.shards[i] = &cache{cacheBytes: shardBytes, policy: policy}
+	}
+	return c
+}
+
+// 根据key选择分片
+func (c *shardedCache) shard(key string) *cache {
+	if len(c.shards) == 1 {
+		return c.shards[0]
+	}
+	return c.shards[hashKey(key)%uint32(len(c.shards))]
+}
+
+// FNV-1a哈希，不分配内存
+func hashKey(key string) uint32 {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return h
+}
+
+func (c *shardedCache) add(key string, value ByteView) {
+	c.shard(key).add(key, value)
+}
+
+// epoch按分片计数、按key判断，所以需要传入key
+func (c *shardedCache) currentEpoch(key string) uint64 {
+	return c.shard(key).currentEpoch()
+}
+
+func (c *shardedCache) addIfEpoch(key string, value ByteView, epoch uint64) {
+	c.shard(key).addIfEpoch(key, value, epoch)
+}
+
+func (c *shardedCache) set(key string, value ByteView) {
+	c.shard(key).set(key, value)
+}
+
+func (c *shardedCache) setIfNewer(key string, value ByteView) uint64 {
+	return c.shard(key).setIfNewer(key, value)
+}
+
+func (c *shardedCache) peek(key string) (ByteView, bool) {
+	return c.shard(key).peek(key)
+}
+
+func (c *shardedCache) removeFunc(match func(key string) bool) int {
+	n := 0
+	for _, s := range c.shards {
+		n += s.removeFunc(match)
+	}
+	return n
+}
+
+func (c *shardedCache) remove(key string) {
+	c.shard(key).remove(key)
+}
+
+func (c *shardedCache) get(key string) (ByteView, bool) {
+	return c.shard(key).get(key)
+}
+
+// 汇总所有分片的统计信息
+func (c *shardedCache) stats() CacheStats {
+	var s CacheStats
+	for _, shard := range c.shards {
+		ss := shard.stats()
+		s.Bytes += ss.Bytes
+		s.Items += ss.Items
+		s.Gets += ss.Gets
+		s.Hits += ss.Hits
+		s.Evictions += ss.Evictions
+	}
+	return s
+}
+
+func (c *shardedCache) removeExpired() int {
+	n := 0
+	for _, shard := range c.shards {
+		n += shard.removeExpired()
+	}
+	return n
+}
+
+// 逐个分片按淘汰顺序遍历，同一个分片内的顺序是有意义的
+func (c *shardedCache) walk(fn func(key string, value ByteView)) {
+	for _, shard := range c.shards {
+		shard.walk(fn)
+	}
+}
+
+// 所有分片共用一个磁盘缓存层，不同分片的key不会重复
+func (c *shardedCache) setDisk(store *disk.Store) {
+	for _, shard := range c.shards {
+		shard.disk = store
+	}
+}
+
+func (c *shardedCache) setStale(stale time.Duration) {
+	for _, shard := range c.shards {
+		shard.stale = stale
+	}
+}
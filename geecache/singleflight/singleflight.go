@@ -8,14 +8,19 @@
 package singleflight
 
 import (
+	"context"
 	"sync"
+	"time"
 )
 
 // call is an in-flight or completed Do call
 type call struct {
-	wg  sync.WaitGroup
-	val interface{}
-	err error
+	done chan struct{} //fn执行完之后关闭，等待的请求可以同时监听自己的ctx
+	val  interface{}
+	err  error
+
+	waiters int                //还在等待结果的请求数，由Group.mu保护
+	cancel  context.CancelFunc //所有请求都不再等待时取消fn的ctx
 }
 
 // Group represents a class of work and forms a namespace in which
@@ -30,26 +35,84 @@ type Group struct {
 // time. If a duplicate comes in, the duplicate caller waits for the
 // original to complete and receives the same results.
 func (g *Group) Do(key string, fn func() (interface{}, error)) (interface{}, error) {
+	return g.DoContext(context.Background(), key, func(context.Context) (interface{}, error) {
+		return fn()
+	})
+}
+
+// DoContext is like Do, but every caller, the first one included, stops
+// waiting and returns ctx.Err() once its own ctx is done. fn runs in its
+// own goroutine with a ctx carrying the values of the first caller's ctx,
+// which is cancelled only once every caller has stopped waiting.
+func (g *Group) DoContext(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
 	g.mu.Lock()
 	if g.m == nil {
 		g.m = make(map[string]*call)
 	}
-	if c, ok := g.m[key]; ok {
-		g.mu.Unlock()
-		c.wg.Wait()
+	c, ok := g.m[key]
+	if !ok {
+		//fn不受第一个请求取消的影响，否则其他还在等待的请求也会拿到第一个请求的错误
+		fctx, cancel := context.WithCancel(detached{ctx})
+		c = &call{done: make(chan struct{}), cancel: cancel}
+		g.m[key] = c
+		go g.run(fctx, key, c, fn)
+	}
+	c.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
 		return c.val, c.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		if c.waiters--; c.waiters == 0 { //没有请求在等待了，fn的结果也没有用了，之后的请求重新执行
+			c.cancel()
+			if g.m[key] == c {
+				delete(g.m, key)
+			}
+		}
+		g.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+func (g *Group) run(ctx context.Context, key string, c *call, fn func(ctx context.Context) (interface{}, error)) {
+	c.val, c.err = fn(ctx)
+	c.cancel()
+	close(c.done)
+
+	g.mu.Lock()
+	if g.m[key] == c { //可能已经被Forget，并且有了新的请求，不能把新的请求删掉
+		delete(g.m, key)
 	}
-	c := new(call)
-	c.wg.Add(1)
-	g.m[key] = c
 	g.mu.Unlock()
+}
+
+// 保留ctx中的值，但是不继承它的取消和截止时间
+type detached struct {
+	context.Context
+}
 
-	c.val, c.err = fn()
-	c.wg.Done()
+func (detached) Deadline() (deadline time.Time, ok bool) { return }
+func (detached) Done() <-chan struct{}                   { return nil }
+func (detached) Err() error                              { return nil }
 
+// Forget tells the singleflight to forget about a key. Future calls
+// to Do for this key will call the function rather than waiting for
+// an earlier call to complete.
+func (g *Group) Forget(key string) {
 	g.mu.Lock()
 	delete(g.m, key)
 	g.mu.Unlock()
+}
 
-	return c.val, c.err
+// ForgetFunc is like Forget for every key for which match returns true.
+func (g *Group) ForgetFunc(match func(key string) bool) {
+	g.mu.Lock()
+	for key := range g.m {
+		if match(key) {
+			delete(g.m, key)
+		}
+	}
+	g.mu.Unlock()
 }
@@ -0,0 +1,184 @@
+/*
+ * @Description:缓存快照，重启之后从快照恢复缓存，避免所有请求都打到数据库上。
+ * 快照格式：魔数"gcsnap"、版本号，之后每条缓存依次是key长度、key、value长度、value、过期时间（UnixNano，0代表永不过期）、
+ * 缓存值的版本，都是varint编码。缓存按淘汰顺序写入，恢复时按顺序写回，最近访问的依然最后被淘汰
+ * @version:
+ * @Author: Steven
+ * @Date: 2023-04-27 20:36:41
+ */
+package geecache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	snapshotMagic   = "gcsnap"
+	snapshotVersion = 1
+)
+
+var errBadSnapshot = errors.New("geecache: not a snapshot")
+
+// WithSnapshot makes the group restore its main cache from the snapshot
+// file at path when it is created, if the file exists, and write a new
+// snapshot there every interval. An interval of 0 only restores; call
+// Snapshot yourself, e.g. on shutdown.
+func WithSnapshot(path string, interval time.Duration) GroupOption {
+	return func(g *Group) {
+		g.snapshotPath = path
+		g.snapshotInterval = interval
+	}
+}
+
+// Snapshot writes the values of the group's main cache, with their
+// expiry and version, to w in eviction order. Values cached from peers
+// are left out, they belong to other nodes.
+func (g *Group) Snapshot(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(snapshotMagic)
+	bw.WriteByte(snapshotVersion)
+	buf := make([]byte, binary.MaxVarintLen64)
+	g.mainCache.walk(func(key string, value ByteView) {
+		bw.Write(buf[:binary.PutUvarint(buf, uint64(len(key)))])
+		bw.WriteString(key)
+		bw.Write(buf[:binary.PutUvarint(buf, uint64(len(value.b)))])
+		bw.Write(value.b)
+		var expire int64
+		if !value.e.IsZero() {
+			expire = value.e.UnixNano()
+		}
+		bw.Write(buf[:binary.PutVarint(buf, expire)])
+		bw.Write(buf[:binary.PutUvarint(buf, value.v)])
+	})
+	return bw.Flush() //bufio.Writer出错之后不再写入，只需要在最后检查一次
+}
+
+// Restore adds the values of a snapshot written by Snapshot to the
+// group's main cache, skipping the ones that have expired since. On a
+// truncated or corrupt snapshot it keeps what it read and returns an
+// error.
+func (g *Group) Restore(r io.Reader) error {
+	br := bufio.NewReader(r)
+	header := make([]byte, len(snapshotMagic)+1)
+	if _, err := io.ReadFull(br, header); err != nil || string(header[:len(snapshotMagic)]) != snapshotMagic {
+		return errBadSnapshot
+	}
+	if format := header[len(snapshotMagic)]; format != snapshotVersion {
+		return fmt.Errorf("geecache: unsupported snapshot version %d", format)
+	}
+	now := time.Now()
+	for {
+		key, err := readSnapshotBytes(br)
+		if err == io.EOF { //正好在一条缓存的开头结束
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		value, err := readSnapshotBytes(br)
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+		expire, err := binary.ReadVarint(br)
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+		v := ByteView{b: value}
+		if v.v, err = binary.ReadUvarint(br); err != nil {
+			return unexpectedEOF(err)
+		}
+		observeVersion(v.v)
+		if expire != 0 {
+			if v.e = time.Unix(0, expire); !now.Before(v.e) {
+				continue
+			}
+		}
+		g.mainCache.add(string(key), v)
+	}
+}
+
+// 读取一个长度加内容的字段。长度是从文件里读出来的，不能直接按它分配内存：
+// 边读边分配，文件损坏时最多分配文件剩下的大小
+func readSnapshotBytes(br *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	if n > math.MaxInt32 {
+		return nil, errBadSnapshot
+	}
+	b, err := io.ReadAll(io.LimitReader(br, int64(n)))
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(b)) != n {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return b, nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// 从快照文件恢复，文件不存在时什么都不做
+func (g *Group) restoreFile() {
+	f, err := os.Open(g.snapshotPath)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err == nil {
+		err = g.Restore(f)
+		f.Close()
+	}
+	if err != nil {
+		log.Printf("[GeeCache] group %s failed to restore %s: %v", g.name, g.snapshotPath, err)
+		return
+	}
+	log.Printf("[GeeCache] group %s restored %d keys from %s", g.name, g.mainCache.stats().Items, g.snapshotPath)
+}
+
+// 写入快照文件：先写临时文件再重命名，写到一半崩溃也不会破坏上一次的快照
+func (g *Group) snapshotFile() error {
+	tmp, err := os.CreateTemp(filepath.Dir(g.snapshotPath), filepath.Base(g.snapshotPath)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) //重命名成功之后删除会失败，忽略即可
+	if err := g.Snapshot(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), g.snapshotPath)
+}
+
+// 后台定期写入快照
+func (g *Group) snapshotLoop() {
+	t := time.NewTicker(g.snapshotInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-g.stop:
+			return
+		}
+		if err := g.snapshotFile(); err != nil {
+			log.Printf("[GeeCache] group %s failed to snapshot to %s: %v", g.name, g.snapshotPath, err)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+/*
+ * @Description:Count-Min Sketch，用很少的内存估算每个key最近的访问频率
+ * @version:
+ * @Author: Steven
+ * @Date: 2023-04-11 09:20:45
+ */
+package tinylfu
+
+import "hash/fnv"
+
+const (
+	sketchDepth = 4  //哈希函数的个数，取估算值中最小的一个
+	maxCount    = 15 //每个计数器最多计到15，只需要区分冷热，不需要精确的次数
+)
+
+// cmSketch is a count-min sketch with 4-bit saturating counters, halved
+// periodically so that old popularity fades away.
+type cmSketch struct {
+	rows      [sketchDepth][]uint8
+	mask      uint64
+	additions int //距离上次衰减已经记录的次数
+	resetAt   int //记录次数达到该值时所有计数器减半
+}
+
+// width必须是2的幂
+func newCMSketch(width int) *cmSketch {
+	s := &cmSketch{mask: uint64(width - 1), resetAt: 10 * width}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+// 每个哈希函数用两个基础哈希值组合出来：h1 + i*h2
+func (s *cmSketch) hashes(key string) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	return sum, sum>>32 | 1
+}
+
+func (s *cmSketch) increment(key string) {
+	h1, h2 := s.hashes(key)
+	for i := range s.rows {
+		idx := (h1 + uint64(i)*h2) & s.mask
+		if s.rows[i][idx] < maxCount {
+			s.rows[i][idx]++
+		}
+	}
+	s.additions++
+	if s.additions >= s.resetAt {
+		s.reset()
+	}
+}
+
+func (s *cmSketch) estimate(key string) uint8 {
+	h1, h2 := s.hashes(key)
+	min := uint8(maxCount)
+	for i := range s.rows {
+		if v := s.rows[i][(h1+uint64(i)*h2)&s.mask]; v < min {
+			min = v
+		}
+	}
+	return min
+}
+
+// 衰减：所有计数器减半，让过去的热点慢慢变冷
+func (s *cmSketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+	s.additions /= 2
+}
@@ -0,0 +1,257 @@
+/*
+ * @Description:W-TinyLFU淘汰策略，新缓存先进入一个很小的LRU窗口，
+ * 从窗口淘汰出来的缓存，只有比主缓存中将被淘汰的缓存访问频率更高，才允许进入主缓存。
+ * 一次性扫描大量冷数据时，不会把热点数据挤出缓存
+ * @version:
+ * @Author: Steven
+ * @Date: 2023-04-11 10:05:17
+ */
+package tinylfu
+
+import (
+	"container/list"
+	"geecache/lru"
+	"time"
+)
+
+// Value use Len to count how many bytes it takes
+type Value = lru.Value
+
+const (
+	windowPercent    = 1  //LRU窗口占总内存的1%
+	protectedPercent = 80 //主缓存中保护区占80%，其余为试用区
+	minSketchWidth   = 1024
+	maxSketchWidth   = 1 << 20
+	bytesPerCounter  = 64 //估算每64字节的缓存需要一个计数器
+)
+
+// Cache is a W-TinyLFU cache sized in bytes. It is not safe for concurrent access.
+type Cache struct {
+	maxBytes     int64
+	windowBytes  int64 //窗口可以使用的内存
+	protectBytes int64 //保护区可以使用的内存
+
+	window    *queue //新写入的缓存
+	probation *queue //试用区：从窗口进入主缓存，还没有再次被访问
+	protected *queue //保护区：在主缓存中至少又被访问过一次
+
+	sketch *cmSketch
+	cache  map[string]*list.Element
+	// optional and executed when an entry is purged.
+	OnEvicted func(key string, value Value)
+}
+
+type entry struct {
+	key    string
+	value  Value
+	size   int64
+	expire time.Time //过期时间，零值代表永不过期
+	q      *queue
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.expire.IsZero() && !now.Before(e.expire)
+}
+
+type queue struct {
+	ll     *list.List
+	nbytes int64
+}
+
+func newQueue() *queue {
+	return &queue{ll: list.New()}
+}
+
+func (q *queue) pushFront(e *entry) *list.Element {
+	e.q = q
+	q.nbytes += e.size
+	return q.ll.PushFront(e)
+}
+
+func (q *queue) remove(ele *list.Element) *entry {
+	e := q.ll.Remove(ele).(*entry)
+	q.nbytes -= e.size
+	return e
+}
+
+// New is the Constructor of Cache
+func New(maxBytes int64, onEvicted func(string, Value)) *Cache {
+	width := minSketchWidth
+	for int64(width) < maxBytes/bytesPerCounter && width < maxSketchWidth {
+		width <<= 1
+	}
+	windowBytes := maxBytes * windowPercent / 100
+	return &Cache{
+		maxBytes:     maxBytes,
+		windowBytes:  windowBytes,
+		protectBytes: (maxBytes - windowBytes) * protectedPercent / 100,
+		window:       newQueue(),
+		probation:    newQueue(),
+		protected:    newQueue(),
+		sketch:       newCMSketch(width),
+		cache:        make(map[string]*list.Element),
+		OnEvicted:    onEvicted,
+	}
+}
+
+// Add adds a value to the cache.
+func (c *Cache) Add(key string, value Value) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+// AddWithExpire adds a value to the cache which expires at the given time.
+// A zero expire means the value never expires.
+func (c *Cache) AddWithExpire(key string, value Value, expire time.Time) {
+	c.sketch.increment(key)
+	size := int64(len(key)) + int64(value.Len())
+	if ele, ok := c.cache[key]; ok {
+		e := ele.Value.(*entry)
+		q := e.q
+		q.remove(ele)
+		e.value, e.size, e.expire = value, size, expire
+		c.cache[key] = q.pushFront(e)
+		c.evict()
+		return
+	}
+	c.cache[key] = c.window.pushFront(&entry{key: key, value: value, size: size, expire: expire})
+	c.evict()
+}
+
+// 窗口超出限制时，窗口队尾的缓存作为候选者进入试用区；
+// 主缓存超出限制时，候选者与试用区队尾的缓存比较访问频率，淘汰频率低的
+func (c *Cache) evict() {
+	if c.maxBytes == 0 {
+		return
+	}
+	for c.window.nbytes > c.windowBytes {
+		candidate := c.window.remove(c.window.ll.Back())
+		c.cache[candidate.key] = c.probation.pushFront(candidate)
+		c.admit(candidate)
+	}
+	for c.Bytes() > c.maxBytes { //只有更新值变大时才会走到这里
+		c.removeElement(c.victim(nil))
+	}
+}
+
+// 候选者的访问频率比victim高才能留下，否则淘汰候选者自己
+func (c *Cache) admit(candidate *entry) {
+	for c.probation.nbytes+c.protected.nbytes > c.maxBytes-c.windowBytes {
+		victim := c.victim(candidate)
+		if victim == nil || c.sketch.estimate(candidate.key) <= c.sketch.estimate(victim.Value.(*entry).key) {
+			c.removeElement(c.cache[candidate.key])
+			return
+		}
+		c.removeElement(victim)
+	}
+}
+
+// 下一个被淘汰的缓存：优先试用区，其次保护区，最后窗口，跳过skip
+func (c *Cache) victim(skip *entry) *list.Element {
+	for _, q := range []*queue{c.probation, c.protected, c.window} {
+		ele := q.ll.Back()
+		if ele != nil && ele.Value.(*entry) == skip {
+			ele = ele.Prev()
+		}
+		if ele != nil {
+			return ele
+		}
+	}
+	return nil
+}
+
+// Get look ups a key's value
+func (c *Cache) Get(key string) (value Value, ok bool) {
+	c.sketch.increment(key) //没有命中也要记录，用来判断之后是否允许进入主缓存
+	ele, ok := c.cache[key]
+	if !ok {
+		return
+	}
+	e := ele.Value.(*entry)
+	if e.expired(time.Now()) {
+		c.removeElement(ele)
+		return nil, false
+	}
+	switch e.q {
+	case c.window, c.protected:
+		e.q.ll.MoveToFront(ele)
+	case c.probation: //试用区的缓存再次被访问，晋升到保护区
+		c.probation.remove(ele)
+		c.cache[key] = c.protected.pushFront(e)
+		for c.protected.nbytes > c.protectBytes { //保护区满了，队尾降级回试用区
+			demoted := c.protected.remove(c.protected.ll.Back())
+			c.cache[demoted.key] = c.probation.pushFront(demoted)
+		}
+	}
+	return e.value, true
+}
+
+// Peek returns the value of key and its expire time without updating
+// its recency or frequency, and without removing it if it has expired.
+func (c *Cache) Peek(key string) (value Value, expire time.Time, ok bool) {
+	ele, ok := c.cache[key] //不记录到频率统计里
+	if !ok {
+		return
+	}
+	e := ele.Value.(*entry)
+	if e.expired(time.Now()) {
+		return nil, time.Time{}, false
+	}
+	return e.value, e.expire, true
+}
+
+// Remove removes the provided key from the cache.
+func (c *Cache) Remove(key string) {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele)
+	}
+}
+
+// RemoveExpired removes all expired items and returns how many were removed.
+func (c *Cache) RemoveExpired() int {
+	now := time.Now()
+	n := 0
+	for _, q := range []*queue{c.window, c.probation, c.protected} {
+		for ele := q.ll.Back(); ele != nil; {
+			prev := ele.Prev()
+			if ele.Value.(*entry).expired(now) {
+				c.removeElement(ele)
+				n++
+			}
+			ele = prev
+		}
+	}
+	return n
+}
+
+// Walk calls fn for every unexpired item in the order victims are
+// chosen: probation, protected, then window, each from the oldest to the
+// newest. fn must not modify the cache.
+func (c *Cache) Walk(fn func(key string, value Value, expire time.Time)) {
+	now := time.Now()
+	for _, q := range []*queue{c.probation, c.protected, c.window} {
+		for ele := q.ll.Back(); ele != nil; ele = ele.Prev() {
+			if e := ele.Value.(*entry); !e.expired(now) {
+				fn(e.key, e.value, e.expire)
+			}
+		}
+	}
+}
+
+func (c *Cache) removeElement(ele *list.Element) {
+	e := ele.Value.(*entry)
+	e.q.remove(ele)
+	delete(c.cache, e.key)
+	if c.OnEvicted != nil {
+		c.OnEvicted(e.key, e.value)
+	}
+}
+
+// Len returns the number of items in the cache.
+func (c *Cache) Len() int {
+	return len(c.cache)
+}
+
+// Bytes returns the number of bytes used by keys and values in the cache.
+func (c *Cache) Bytes() int64 {
+	return c.window.nbytes + c.probation.nbytes + c.protected.nbytes
+}
@@ -0,0 +1,89 @@
+/*
+ * @Description:
+ * @version:
+ * @Author: Steven
+ * @Date: 2023-04-11 11:30:52
+ */
+package tinylfu
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+func TestGet(t *testing.T) {
+	lfu := New(int64(0), nil)
+	lfu.Add("key1", String("1234"))
+	if v, ok := lfu.Get("key1"); !ok || string(v.(String)) != "1234" {
+		t.Fatalf("cache hit key1=1234 failed")
+	}
+	if _, ok := lfu.Get("key2"); ok {
+		t.Fatalf("cache miss key2 failed")
+	}
+}
+
+func TestAdmission(t *testing.T) {
+	lfu := New(int64(10), nil)
+	lfu.Add("k1", String("v1"))
+	lfu.Add("k2", String("v2"))
+	for i := 0; i < 3; i++ {
+		lfu.Get("k1")
+		lfu.Get("k2")
+	}
+	lfu.Add("k3", String("v3")) // k3 has been seen once, less than the victim
+
+	if _, ok := lfu.Get("k3"); ok {
+		t.Fatalf("cold k3 should not be admitted")
+	}
+	for i := 0; i < 5; i++ {
+		lfu.Get("k4") // k4 is popular before it is even cached
+	}
+	lfu.Add("k4", String("v4"))
+	if _, ok := lfu.Get("k4"); !ok || lfu.Bytes() > 10 {
+		t.Fatalf("popular k4 should be admitted")
+	}
+}
+
+func TestScanResistance(t *testing.T) {
+	lfu := New(int64(1000), nil)
+	for i := 0; i < 20; i++ {
+		lfu.Add("hot"+strconv.Itoa(i), String("v"))
+	}
+	for j := 0; j < 3; j++ {
+		for i := 0; i < 20; i++ {
+			lfu.Get("hot" + strconv.Itoa(i))
+		}
+	}
+	for i := 0; i < 5000; i++ {
+		lfu.Add("scan"+strconv.Itoa(i), String("v"))
+	}
+	for i := 0; i < 20; i++ {
+		if _, ok := lfu.Get("hot" + strconv.Itoa(i)); !ok {
+			t.Fatalf("hot%d was flushed by the scan", i)
+		}
+	}
+	if lfu.Bytes() > 1000 {
+		t.Fatalf("cache uses %d bytes, more than 1000", lfu.Bytes())
+	}
+}
+
+func TestExpire(t *testing.T) {
+	lfu := New(int64(0), nil)
+	lfu.AddWithExpire("key1", String("1234"), time.Now().Add(-time.Second))
+	lfu.AddWithExpire("key2", String("5678"), time.Now().Add(-time.Second))
+	lfu.Add("key3", String("90"))
+
+	if _, ok := lfu.Get("key1"); ok || lfu.Len() != 2 {
+		t.Fatalf("expired key1 should be a miss and removed")
+	}
+	if n := lfu.RemoveExpired(); n != 1 || lfu.Len() != 1 {
+		t.Fatalf("RemoveExpired removed %d, %d left", n, lfu.Len())
+	}
+}
@@ -0,0 +1,264 @@
+/*
+ * @Description:节点之间通信的二进制协议。
+ * 每个消息以魔数和协议版本开头，之后是若干个字段，每个字段为：1字节字段编号 + uvarint长度 + 字段内容。
+ * 解码时跳过不认识的字段，新版本增加字段时，旧节点依然可以解码
+ * @version:
+ * @Author: Steven
+ * @Date: 2023-04-15 16:40:12
+ */
+package wire
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// ContentType is the media type of a frame, used for content negotiation
+	// over HTTP. Peers that do not send it in Accept get raw bytes instead.
+	ContentType = "application/x-geecache-frame"
+
+	// Version is the protocol version written by this package.
+	Version = 1
+
+	magic0, magic1 = 'g', 'c'
+)
+
+// 字段编号，一旦发布就不能修改含义
+const (
+	tagGroup byte = iota + 1
+	tagKey
+	tagValue
+	tagTTL
+	tagCode
+	tagErr
+	tagKeys //可以出现多次，每次一个key
+	tagItem //可以出现多次，每次一个嵌套的响应帧
+	tagVersion
+	tagTimeout
+	tagID
+	tagToken
+)
+
+// Code classifies the outcome of a request.
+type Code uint8
+
+const (
+	CodeOK         Code = iota // 成功
+	CodeBadRequest             // 请求格式不对
+	CodeNoGroup                // 分组不存在
+	CodeLoadError              // 加载缓存值失败
+	CodeNotFound               // 数据源中没有该key
+)
+
+// Request asks a peer for the value of Key in Group, or for the values of
+// all Keys at once. Timeout and ID are for transports that can't cancel
+// a request themselves: Timeout is how long the caller still waits, and
+// ID names the request in a later cancel. Token authenticates requests
+// that change the peer's cache, on transports without headers.
+type Request struct {
+	Group   string
+	Key     string
+	Keys    []string
+	Timeout time.Duration // 请求方剩余的等待时间，0代表不限制
+	ID      uint64        // 请求编号，0代表请求不能取消
+	Token   string        // 节点之间的令牌
+}
+
+// Response carries a value and its remaining time to live, or an error.
+type Response struct {
+	Group   string
+	Key     string
+	Value   []byte
+	TTL     time.Duration // 剩余有效期，0代表永不过期
+	Code    Code
+	Err     string
+	Version uint64 // 缓存值在所属节点上的版本，0代表所属节点不支持版本
+}
+
+// MarshalBinary encodes r as a frame.
+func (r *Request) MarshalBinary() ([]byte, error) {
+	e := newEncoder()
+	e.string(tagGroup, r.Group)
+	e.string(tagKey, r.Key)
+	for _, key := range r.Keys {
+		e.string(tagKeys, key)
+	}
+	e.varint(tagTimeout, int64(r.Timeout))
+	e.uvarint(tagID, r.ID)
+	e.string(tagToken, r.Token)
+	return e.buf, nil
+}
+
+// UnmarshalBinary decodes a frame into r.
+func (r *Request) UnmarshalBinary(data []byte) error {
+	return decode(data, func(tag byte, b []byte) (err error) {
+		switch tag {
+		case tagGroup:
+			r.Group = string(b)
+		case tagKey:
+			r.Key = string(b)
+		case tagKeys:
+			r.Keys = append(r.Keys, string(b))
+		case tagTimeout:
+			var timeout int64
+			timeout, err = varint(b)
+			r.Timeout = time.Duration(timeout)
+		case tagID:
+			r.ID, err = uvarint(b)
+		case tagToken:
+			r.Token = string(b)
+		}
+		return
+	})
+}
+
+// MarshalBinary encodes r as a frame.
+func (r *Response) MarshalBinary() ([]byte, error) {
+	e := newEncoder()
+	e.string(tagGroup, r.Group)
+	e.string(tagKey, r.Key)
+	e.bytes(tagValue, r.Value)
+	e.varint(tagTTL, int64(r.TTL))
+	e.varint(tagCode, int64(r.Code))
+	e.string(tagErr, r.Err)
+	e.uvarint(tagVersion, r.Version)
+	return e.buf, nil
+}
+
+// UnmarshalBinary decodes a frame into r.
+func (r *Response) UnmarshalBinary(data []byte) error {
+	return decode(data, func(tag byte, b []byte) (err error) {
+		switch tag {
+		case tagGroup:
+			r.Group = string(b)
+		case tagKey:
+			r.Key = string(b)
+		case tagValue:
+			r.Value = append([]byte(nil), b...)
+		case tagTTL:
+			var ttl int64
+			ttl, err = varint(b)
+			r.TTL = time.Duration(ttl)
+		case tagCode:
+			var code int64
+			code, err = varint(b)
+			r.Code = Code(code)
+		case tagErr:
+			r.Err = string(b)
+		case tagVersion:
+			r.Version, err = uvarint(b)
+		}
+		return
+	})
+}
+
+// BatchResponse answers a Request with Keys, one Response per key in order.
+type BatchResponse struct {
+	Items []Response
+}
+
+// MarshalBinary encodes r as a frame.
+func (r *BatchResponse) MarshalBinary() ([]byte, error) {
+	e := newEncoder()
+	for i := range r.Items {
+		item, _ := r.Items[i].MarshalBinary()
+		e.bytes(tagItem, item)
+	}
+	return e.buf, nil
+}
+
+// UnmarshalBinary decodes a frame into r.
+func (r *BatchResponse) UnmarshalBinary(data []byte) error {
+	return decode(data, func(tag byte, b []byte) error {
+		if tag != tagItem {
+			return nil
+		}
+		var item Response
+		if err := item.UnmarshalBinary(b); err != nil {
+			return err
+		}
+		r.Items = append(r.Items, item)
+		return nil
+	})
+}
+
+type encoder struct {
+	buf []byte
+}
+
+func newEncoder() *encoder {
+	return &encoder{buf: []byte{magic0, magic1, Version}}
+}
+
+// 零值字段不写入，解码时就是零值
+func (e *encoder) bytes(tag byte, b []byte) {
+	if len(b) == 0 {
+		return
+	}
+	e.buf = append(e.buf, tag)
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+func (e *encoder) string(tag byte, s string) {
+	e.bytes(tag, []byte(s))
+}
+
+func (e *encoder) varint(tag byte, v int64) {
+	if v == 0 {
+		return
+	}
+	e.bytes(tag, binary.AppendVarint(nil, v))
+}
+
+func (e *encoder) uvarint(tag byte, v uint64) {
+	if v == 0 {
+		return
+	}
+	e.bytes(tag, binary.AppendUvarint(nil, v))
+}
+
+var errShortFrame = errors.New("wire: short frame")
+
+// 校验魔数和版本，然后依次把每个字段交给fn处理
+func decode(data []byte, fn func(tag byte, b []byte) error) error {
+	if len(data) < 3 || data[0] != magic0 || data[1] != magic1 {
+		return errors.New("wire: not a geecache frame")
+	}
+	if data[2] != Version {
+		return fmt.Errorf("wire: unsupported version %d", data[2])
+	}
+	data = data[3:]
+	for len(data) > 0 {
+		tag := data[0]
+		n, w := binary.Uvarint(data[1:])
+		if w <= 0 || uint64(len(data)-1-w) < n {
+			return errShortFrame
+		}
+		start := 1 + w
+		if err := fn(tag, data[start:start+int(n)]); err != nil {
+			return err
+		}
+		data = data[start+int(n):]
+	}
+	return nil
+}
+
+func varint(b []byte) (int64, error) {
+	v, n := binary.Varint(b)
+	if n != len(b) {
+		return 0, errShortFrame
+	}
+	return v, nil
+}
+
+func uvarint(b []byte) (uint64, error) {
+	v, n := binary.Uvarint(b)
+	if n != len(b) {
+		return 0, errShortFrame
+	}
+	return v, nil
+}
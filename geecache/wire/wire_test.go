@@ -0,0 +1,78 @@
+package wire
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestResponseRoundTrip(t *testing.T) {
+	in := &Response{Group: "scores", Key: "Tom", Value: []byte("630"), TTL: time.Minute, Version: 1 << 60}
+	data, _ := in.MarshalBinary()
+	var out Response
+	if err := out.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, &out) {
+		t.Fatalf("expect %+v, got %+v", in, out)
+	}
+
+	in = &Response{Code: CodeLoadError, Err: "Tom not exist"}
+	data, _ = in.MarshalBinary()
+	out = Response{}
+	if err := out.UnmarshalBinary(data); err != nil || !reflect.DeepEqual(in, &out) {
+		t.Fatalf("expect %+v, got %+v %v", in, out, err)
+	}
+}
+
+func TestRequestRoundTrip(t *testing.T) {
+	in := &Request{Group: "scores", Key: "Tom", Timeout: time.Second, ID: 1 << 60, Token: "secret"}
+	data, _ := in.MarshalBinary()
+	var out Request
+	if err := out.UnmarshalBinary(data); err != nil || !reflect.DeepEqual(in, &out) {
+		t.Fatalf("expect %+v, got %+v %v", in, out, err)
+	}
+}
+
+func TestUnknownField(t *testing.T) {
+	e := newEncoder()
+	e.string(tagKey, "Tom")
+	e.string(99, "from a newer peer")
+	var req Request
+	if err := req.UnmarshalBinary(e.buf); err != nil || req.Key != "Tom" {
+		t.Fatalf("unknown fields should be skipped, got %+v %v", req, err)
+	}
+}
+
+func TestBadFrame(t *testing.T) {
+	var req Request
+	for _, data := range [][]byte{
+		[]byte("630"),
+		{magic0, magic1, Version + 1},
+		{magic0, magic1, Version, tagKey, 10, 'T'},
+	} {
+		if err := req.UnmarshalBinary(data); err == nil {
+			t.Fatalf("%q should not decode", data)
+		}
+	}
+}
+
+func TestBatchRoundTrip(t *testing.T) {
+	req := &Request{Group: "scores", Keys: []string{"Tom", "Jack", "unknown"}}
+	data, _ := req.MarshalBinary()
+	var gotReq Request
+	if err := gotReq.UnmarshalBinary(data); err != nil || !reflect.DeepEqual(req, &gotReq) {
+		t.Fatalf("expect %+v, got %+v %v", req, gotReq, err)
+	}
+
+	res := &BatchResponse{Items: []Response{
+		{Key: "Tom", Value: []byte("630")},
+		{Key: "Jack", Value: []byte("589"), TTL: time.Second},
+		{Key: "unknown", Code: CodeLoadError, Err: "unknown not exist"},
+	}}
+	data, _ = res.MarshalBinary()
+	var got BatchResponse
+	if err := got.UnmarshalBinary(data); err != nil || !reflect.DeepEqual(res, &got) {
+		t.Fatalf("expect %+v, got %+v %v", res, got, err)
+	}
+}
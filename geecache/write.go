@@ -0,0 +1,394 @@
+/*
+ * @Description:写缓存。Set把值发给负责该key的节点，由该节点写入缓存，并通过Setter写回数据源。
+ * 同步写（write-through）：先写数据源，成功之后才写缓存；
+ * 异步写（write-behind）：先写缓存，之后在后台批量写数据源，同一个key只写最后一次的值。
+ * 每次写入都会分配新的版本，CompareAndSet只有在版本没有变化时才写入，用来实现安全的读-改-写
+ * @version:
+ * @Author: Steven
+ * @Date: 2023-05-02 19:31:07
+ */
+package geecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// A Setter persists a value written with Group.Set to the data source.
+type Setter interface {
+	Set(ctx context.Context, key string, value []byte) error
+}
+
+// A SetterFunc implements Setter with a function.
+type SetterFunc func(ctx context.Context, key string, value []byte) error
+
+// Set implements Setter interface function
+func (f SetterFunc) Set(ctx context.Context, key string, value []byte) error {
+	return f(ctx, key, value)
+}
+
+// 数据源如果可以一次写入多个key，就实现BatchSetter接口，异步写时一批只调用一次
+// A BatchSetter persists many values at once. A write-behind group uses
+// it, if its Setter implements it, to flush a batch in one call.
+type BatchSetter interface {
+	SetMany(ctx context.Context, keys []string, values [][]byte) error
+}
+
+// ErrVersionMismatch is returned by CompareAndSet when the value of the
+// key has been replaced since the caller read it.
+var ErrVersionMismatch = errors.New("geecache: version mismatch")
+
+var errNoPeerSetter = errors.New("geecache: peer does not support Set")
+
+const (
+	defaultWriteBehindBatch    = 100
+	defaultWriteBehindInterval = time.Second
+	writeStripes               = 64
+)
+
+// WithWriteThrough makes Set persist the value through s on the node
+// owning the key before caching it. Set fails, and caches nothing, if s
+// fails.
+func WithWriteThrough(s Setter) GroupOption {
+	return func(g *Group) {
+		g.setter = s
+		g.behind = nil
+	}
+}
+
+// WithWriteBehind makes Set cache the value at once and persist it
+// through s in the background, every interval or as soon as maxBatch
+// keys are pending; an interval <= 0 means every second and a maxBatch
+// <= 0 means 100. Only the last value set for a key is persisted.
+// Values that fail to persist are retried with the next batch; they are
+// lost if the process exits first, so call Flush before shutting down.
+func WithWriteBehind(s Setter, interval time.Duration, maxBatch int) GroupOption {
+	return func(g *Group) {
+		if maxBatch <= 0 {
+			maxBatch = defaultWriteBehindBatch
+		}
+		if interval <= 0 { //time.NewTicker不接受非正数的间隔，后台协程panic会导致整个进程退出
+			interval = defaultWriteBehindInterval
+		}
+		g.setter = s
+		g.behind = &writeBehind{
+			setter:   s,
+			interval: interval,
+			maxBatch: maxBatch,
+			pending:  make(map[string][]byte),
+			full:     make(chan struct{}, 1),
+		}
+	}
+}
+
+// Set writes value under key to the node owning key, and to every owner
+// if keys are replicated. See SetContext.
+func (g *Group) Set(key string, value []byte) error {
+	return g.SetContext(context.Background(), key, value)
+}
+
+// SetContext writes value under key with the group's default ttl. The
+// first owner of key gives it a new version, caches it, persists it
+// through the group's Setter, if any, and copies it to the other owners,
+// which keep it unless they have a newer version. If the first owner
+// can't be reached the next one takes the write; any other error is
+// returned as is. An error copying the value to an owner is returned
+// too, though the value has been written. A copy of key in this node's
+// hot cache is dropped.
+func (g *Group) SetContext(ctx context.Context, key string, value []byte) error {
+	_, err := g.write(ctx, key, g.pickOwners(key), func(ctx context.Context, ps PeerSetter) (uint64, error) {
+		return ps.Set(ctx, g.name, key, value, 0)
+	}, func() (uint64, error) {
+		return g.setLocally(ctx, key, value, 0)
+	})
+	return err
+}
+
+// CompareAndSet is like Set, but only replaces the value if its version
+// is still expected, and returns the new version. See
+// CompareAndSetContext.
+func (g *Group) CompareAndSet(key string, expected uint64, value []byte) (uint64, error) {
+	return g.CompareAndSetContext(context.Background(), key, expected, value)
+}
+
+// CompareAndSetContext writes value under key only if the version of the
+// current value, as returned by ByteView.Version, is expected. It returns
+// ErrVersionMismatch otherwise, and the caller should Get the key again
+// and retry. An expected version of 0 means key must not exist in the
+// data source. The check is made by the primary owner of key, loading it
+// first if it isn't cached. With replication it fails if the primary
+// owner is down rather than going to another owner, so that two nodes
+// never check the same key in different places.
+func (g *Group) CompareAndSetContext(ctx context.Context, key string, expected uint64, value []byte) (uint64, error) {
+	peer, self := g.pickPrimary(key)
+	if self {
+		peer = nil
+	}
+	return g.write(ctx, key, []PeerGetter{peer}, func(ctx context.Context, ps PeerSetter) (uint64, error) {
+		return ps.CompareAndSet(ctx, g.name, key, expected, value)
+	}, func() (uint64, error) {
+		return g.compareAndSetLocally(ctx, key, expected, value)
+	})
+}
+
+// 把写入依次交给owners中的节点，nil代表本节点，执行local，否则对节点执行remote。
+// 只有节点不可达时才换下一个节点，其他错误说明节点已经处理了写入，直接返回
+func (g *Group) write(ctx context.Context, key string, owners []PeerGetter,
+	remote func(context.Context, PeerSetter) (uint64, error), local func() (uint64, error)) (uint64, error) {
+	if key == "" {
+		return 0, fmt.Errorf("key is required")
+	}
+	g.hotCache.remove(key) //本节点上的旧值作废
+	g.negCache.remove(key)
+	var err error
+	for _, peer := range owners {
+		if peer == nil {
+			return local()
+		}
+		ps, ok := peer.(PeerSetter)
+		if !ok {
+			return 0, errNoPeerSetter
+		}
+		var version uint64
+		if version, err = remote(ctx, ps); !isUnreachable(err) || ctx.Err() != nil {
+			return version, err
+		}
+		log.Printf("[GeeCache] owner of %s is unreachable, trying the next one: %v", key, err)
+	}
+	return 0, err
+}
+
+// unreachableError是请求没有送达节点的错误，写入可以交给下一个负责的节点
+type unreachableError struct {
+	err error
+}
+
+func (e unreachableError) Error() string { return e.err.Error() }
+func (e unreachableError) Unwrap() error { return e.err }
+
+func isUnreachable(err error) bool {
+	return errors.As(err, new(unreachableError))
+}
+
+// 负责key的第一个节点，不考虑健康状态，self为true时是本节点。
+// 节点池不能告诉第一个节点时，和Get一样选择
+func (g *Group) pickPrimary(key string) (peer PeerGetter, self bool) {
+	if pp, ok := g.peers.(PrimaryPicker); ok {
+		return pp.PickPrimary(key)
+	}
+	if peers, local := g.pickPeers(key); !local {
+		return peers[0], false
+	}
+	return nil, true
+}
+
+// 复制给其他副本，它们按version写缓存，不写数据源。不健康的副本也要复制，复制失败时返回错误
+func (g *Group) replicate(ctx context.Context, key string, value []byte, version uint64) error {
+	var err error
+	for _, peer := range g.pickOwners(key) {
+		if peer == nil {
+			continue
+		}
+		ps, ok := peer.(PeerSetter)
+		if !ok {
+			err = errNoPeerSetter
+			continue
+		}
+		if _, e := ps.Set(ctx, g.name, key, value, version); e != nil && err == nil {
+			err = fmt.Errorf("geecache: replicate %s: %v", key, e) //不能当成本节点不可达，写入已经完成了
+		}
+	}
+	return err
+}
+
+// 写入本节点的主缓存，返回缓存值的版本。version为0时本节点负责key，分配新的版本，写数据源，
+// 再复制给其他副本；否则是负责key的节点发来的副本，版本比缓存中的新才写入，返回缓存中保留的版本
+func (g *Group) setLocally(ctx context.Context, key string, value []byte, version uint64) (uint64, error) {
+	if version != 0 {
+		//副本不加锁：负责key的节点复制时持有自己的锁，副本再加锁的话，两个节点互相复制同一把锁上的key时会死锁。
+		//比较版本就够了，先后到达的两次写入，所有副本都保留版本大的那个
+		observeVersion(version) //本节点之后接手写入时，分配的版本比见过的都大
+		view := g.newView(value, 0)
+		view.v = version
+		kept := g.mainCache.setIfNewer(key, view)
+		if kept == version {
+			g.negCache.remove(key)
+			g.loader.Forget(key)
+		}
+		return kept, nil
+	}
+	unlock := g.lockKey(key)
+	defer unlock()
+	version, err := g.storeLocked(ctx, key, value)
+	if err != nil {
+		return 0, err
+	}
+	//持有key的锁复制，同一个key的写入依次到达副本
+	return version, g.replicate(ctx, key, value, version)
+}
+
+// 只有当前版本等于expected时才写入。本节点没有缓存时先加载，数据源中没有该key时版本为0
+func (g *Group) compareAndSetLocally(ctx context.Context, key string, expected uint64, value []byte) (uint64, error) {
+	unlock := g.lockKey(key)
+	defer unlock()
+	current, ok := g.mainCache.get(key)
+	if !ok {
+		var err error
+		current, err = g.getLocally(ctx, key)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return 0, err
+		}
+	}
+	if current.v != expected {
+		return 0, ErrVersionMismatch
+	}
+	version, err := g.storeLocked(ctx, key, value)
+	if err != nil {
+		return 0, err
+	}
+	return version, g.replicate(ctx, key, value, version)
+}
+
+// 分配新的版本写入缓存和数据源，调用前必须持有key的写锁
+func (g *Group) storeLocked(ctx context.Context, key string, value []byte) (uint64, error) {
+	if g.setter != nil && g.behind == nil { //同步写：数据源写成功才写缓存
+		if err := g.setter.Set(ctx, key, value); err != nil {
+			return 0, err
+		}
+	}
+	view := g.newView(value, 0)
+	g.storeView(key, view, view.v)
+	if g.behind != nil {
+		g.behind.add(key, view.b)
+	}
+	return view.v, nil
+}
+
+// 按version写入主缓存，覆盖原来的值，不比较版本
+func (g *Group) storeView(key string, view ByteView, version uint64) {
+	view.v = version
+	g.mainCache.set(key, view) //正在进行的加载拿到的是旧值，不能再写入缓存
+	g.negCache.remove(key)
+	g.loader.Forget(key)
+}
+
+// 同一个key的写入和比较写入依次执行，按key的哈希值分到writeStripes把锁上
+func (g *Group) lockKey(key string) (unlock func()) {
+	mu := &g.writeMu[hashKey(key)%writeStripes]
+	mu.Lock()
+	return mu.Unlock
+}
+
+// Flush persists the values pending in a write-behind group now.
+func (g *Group) Flush(ctx context.Context) error {
+	if g.behind == nil {
+		return nil
+	}
+	return g.behind.flush(ctx)
+}
+
+// 异步写数据源的队列
+type writeBehind struct {
+	setter   Setter
+	interval time.Duration
+	maxBatch int
+	full     chan struct{} //待写入的key达到maxBatch时通知后台立刻写入
+
+	mu      sync.Mutex
+	pending map[string][]byte //同一个key多次写入，只保留最后一次的值
+	flushMu sync.Mutex        //同一时间只有一次写入
+}
+
+func (w *writeBehind) add(key string, value []byte) {
+	w.mu.Lock()
+	w.pending[key] = value
+	n := len(w.pending)
+	w.mu.Unlock()
+	if n >= w.maxBatch {
+		select {
+		case w.full <- struct{}{}:
+		default: //已经通知过了
+		}
+	}
+}
+
+// 后台定期写入，或者待写入的key达到maxBatch时立刻写入，stop关闭时写入剩下的key之后退出
+func (w *writeBehind) run(stop <-chan struct{}) {
+	t := time.NewTicker(w.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-w.full:
+		case <-stop:
+			if err := w.flush(context.Background()); err != nil {
+				log.Println("[GeeCache] write behind:", err)
+			}
+			return
+		}
+		if err := w.flush(context.Background()); err != nil {
+			log.Println("[GeeCache] write behind:", err)
+		}
+	}
+}
+
+// 写入所有待写入的key，每批最多maxBatch个。失败的key放回队列，除非期间又有了新的值
+func (w *writeBehind) flush(ctx context.Context) error {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+	w.mu.Lock()
+	pending := w.pending
+	w.pending = make(map[string][]byte)
+	w.mu.Unlock()
+
+	keys := make([]string, 0, len(pending))
+	for key := range pending {
+		keys = append(keys, key)
+	}
+	var err error
+	for len(keys) > 0 {
+		n := len(keys)
+		if n > w.maxBatch {
+			n = w.maxBatch
+		}
+		batch := keys[:n]
+		keys = keys[n:]
+		for _, key := range w.persist(ctx, batch, pending) {
+			if err == nil {
+				err = fmt.Errorf("failed to persist %s", key)
+			}
+			w.mu.Lock()
+			if _, newer := w.pending[key]; !newer {
+				w.pending[key] = pending[key]
+			}
+			w.mu.Unlock()
+		}
+	}
+	return err
+}
+
+// 写入一批key，返回失败的key
+func (w *writeBehind) persist(ctx context.Context, keys []string, values map[string][]byte) (failed []string) {
+	if bs, ok := w.setter.(BatchSetter); ok {
+		vs := make([][]byte, len(keys))
+		for i, key := range keys {
+			vs[i] = values[key]
+		}
+		if err := bs.SetMany(ctx, keys, vs); err != nil {
+			log.Printf("[GeeCache] failed to persist %d keys: %v", len(keys), err)
+			return keys
+		}
+		return nil
+	}
+	for _, key := range keys {
+		if err := w.setter.Set(ctx, key, values[key]); err != nil {
+			log.Printf("[GeeCache] failed to persist %s: %v", key, err)
+			failed = append(failed, key)
+		}
+	}
+	return failed
+}
@@ -59,6 +59,14 @@ var _ io.Closer = (*Client)(nil)
 
 var ErrShutdown = errors.New("connection is shut down")
 
+// ServerError is the error returned by a service method on the server,
+// as opposed to an error sending the call or reading its reply.
+type ServerError string
+
+func (e ServerError) Error() string {
+	return string(e)
+}
+
 // Close the connection
 func (client *Client) Close() error {
 	client.mu.Lock()
@@ -97,6 +105,16 @@ func (client *Client) removeCall(seq uint64) *Call {
 	return call
 }
 
+// 调用方不再等待时删除call。call.Seq由send协程在持有client.mu时写入，这里也要持有client.mu读取；
+// call还没有注册时什么都不做，之后的响应照常处理
+func (client *Client) abandonCall(call *Call) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if client.pending[call.Seq] == call {
+		delete(client.pending, call.Seq)
+	}
+}
+
 // 服务端或客户端发生错误时调用，将 shutdown 设置为 true，且将错误信息通知所有 pending 状态的 call。
 func (client *Client) terminateCalls(err error) {
 	client.sending.Lock() //不能跟send方法产生数据冲突
@@ -127,9 +145,9 @@ func (client *Client) receive() {
 			// and call was already removed.
 			err = client.cc.ReadBody(nil) //这个时候不需要获取body数据了，gob.Decode(nil)标识丢弃该值
 		case h.Error != "": //call 存在，但服务端存现错误
-			call.Error = fmt.Errorf(h.Error)
-			err = client.cc.ReadBody(nil) //一样将服务端返回的body信息丢弃！如果不丢弃，就会数据错乱
-			call.done()                   //调用结束，通知调用方
+			call.Error = ServerError(h.Error) //和连接出错区分开，调用方可以知道服务端已经处理了请求
+			err = client.cc.ReadBody(nil)     //一样将服务端返回的body信息丢弃！如果不丢弃，就会数据错乱
+			call.done()                       //调用结束，通知调用方
 		default: //call 存在，服务端处理正常，那么需要从 body 中读取 Reply 的值。
 			err = client.cc.ReadBody(call.Reply)
 			if err != nil {
@@ -292,7 +310,7 @@ func (client *Client) Call(ctx context.Context, serviceMethod string, args, repl
 	//阻塞直到服务端业务处理完毕，发送完响应结果，客户端receive方法接收完毕，这才会结束阻塞！
 	select {
 	case <-ctx.Done(): //当先执行该case，则说明超时了！这里超时，就包括：发送报文超时、等待服务端处理超时、接收服务端响应的报文导致超时！
-		client.removeCall(call.Seq)
+		client.abandonCall(call)
 		return errors.New("rpc client: call failed: " + ctx.Err().Error())
 	case call := <-call.Done:
 		return call.Error
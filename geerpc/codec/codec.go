@@ -31,7 +31,7 @@ type Type string
 //制定了两种Codec,即gob和json
 const (
 	GobType  Type = "application/gob"
-	JsonType Type = "application/json" // not implemented
+	JsonType Type = "application/json"
 )
 
 var NewCodecFuncMap map[Type]NewCodecFunc
@@ -39,4 +39,5 @@ var NewCodecFuncMap map[Type]NewCodecFunc
 func init() { //NewCodecFuncMap的初始化
 	NewCodecFuncMap = make(map[Type]NewCodecFunc)
 	NewCodecFuncMap[GobType] = NewGobCodec //客户端和服务端可以通过 Codec 的 Type 得到构造函数
+	NewCodecFuncMap[JsonType] = NewJsonCodec
 }
@@ -54,6 +54,16 @@ func (server *Server) Register(rcvr interface{}) error {
 	return nil
 }
 
+// RegisterName is like Register but uses name as the service name
+// instead of the type name of rcvr.
+func (server *Server) RegisterName(name string, rcvr interface{}) error {
+	s := newNamedService(name, rcvr)
+	if _, dup := server.serviceMap.LoadOrStore(s.name, s); dup {
+		return errors.New("rpc: service already defined: " + s.name)
+	}
+	return nil
+}
+
 // 方便直接利用默认服务来注册
 func Register(rcvr interface{}) error { return DefaultServer.Register(rcvr) }
 
@@ -124,7 +134,8 @@ func (server *Server) ServeConn(conn io.ReadWriteCloser) {
 	//此时这里就会结束阻塞！
 	//因为我们在main函数中，首先向连接发送的是协商协议内容，即默认的geerpc.DefaultOption
 	//所以这里解码之后opt的值就是geerpc.DefaultOption
-	if err := json.NewDecoder(conn).Decode(&opt); err != nil {
+	dec := json.NewDecoder(conn)
+	if err := dec.Decode(&opt); err != nil {
 		log.Println("rpc server: options error: ", err)
 		return
 	}
@@ -141,7 +152,25 @@ func (server *Server) ServeConn(conn io.ReadWriteCloser) {
 	//f(conn)就是调用opt.CodecType加密方式的构造函数，返回的是该加密结构体的实例指针
 	//结构体实例指针作为参数，调用server.serveCodec方法
 	//协议信息校验完毕，开始等待用户发送的header和body信息，进而进行处理
-	server.serveCodec(f(conn))
+	//客户端紧接着Option发送的请求可能已经被dec读进了缓冲区，编解码时要先读这部分
+	r := io.MultiReader(dec.Buffered(), conn)
+	//json.Encoder在Option后面写了一个换行，要跳过它，否则会被当成请求的开头
+	var newline [1]byte
+	if _, err := io.ReadFull(r, newline[:]); err != nil || newline[0] != '\n' {
+		log.Println("rpc server: options error: missing newline")
+		return
+	}
+	server.serveCodec(f(&bufferedConn{Reader: r, ReadWriteCloser: conn}))
+}
+
+// 读取时先读解码Option时多读的内容，写入和关闭直接使用连接
+type bufferedConn struct {
+	io.Reader
+	io.ReadWriteCloser
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.Reader.Read(p)
 }
 
 // invalidRequest is a placeholder for response argv when error occurs
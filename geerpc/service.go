@@ -63,19 +63,23 @@ type service struct {
 
 // 一个结构体的实例化
 func newService(rcvr interface{}) *service {
-	s := new(service)
-	//func reflect.ValueOf(i any) reflect.Value
-	s.rcvr = reflect.ValueOf(rcvr) //通过反射操控一个类型，一般都得先将其转化为reflect.Value或者reflect.type
-	//func reflect.TypeOf(i any) reflect.Type
-	s.typ = reflect.TypeOf(rcvr)
-
 	//func reflect.Indirect(v reflect.Value) reflect.Value
 	//获取参数rcvr的类型名，是实参类型名，而且这里获取到的类型名是不带包名的，也不带指针，因为reflect.Indirect(s.rcvr)返回的是具体值！
 	//而s.typ是带有类型名的，还会再包名前面带上指针符号
-	s.name = reflect.Indirect(s.rcvr).Type().Name()
 	//为啥不直接s.name = s.typ.Name(),因为s.typ.Name()获取不到
 	//当rcvr实参类型为指针或者接口，那么可以使用下面方式获取类型名
 	//s.name = s.typ.Elem().Name()
+	return newNamedService(reflect.Indirect(reflect.ValueOf(rcvr)).Type().Name(), rcvr)
+}
+
+// 指定服务名，结构体本身可以不导出
+func newNamedService(name string, rcvr interface{}) *service {
+	s := new(service)
+	//func reflect.ValueOf(i any) reflect.Value
+	s.rcvr = reflect.ValueOf(rcvr) //通过反射操控一个类型，一般都得先将其转化为reflect.Value或者reflect.type
+	//func reflect.TypeOf(i any) reflect.Type
+	s.typ = reflect.TypeOf(rcvr)
+	s.name = name
 
 	if !ast.IsExported(s.name) { //判断类型是否是可导出的！
 		log.Fatalf("rpc server: %s is not a valid service name", s.name)
@@ -12,6 +12,7 @@ import (
 	"geecache"
 	"log"
 	"net/http"
+	"time"
 )
 
 var db = map[string]string{
@@ -33,10 +34,16 @@ func createGroup() *geecache.Group {
 }
 
 // 启动缓存服务器
-func startCacheServer(addr string, addrs []string, gee *geecache.Group) {
+// registry不为空时，通过注册中心发现其他节点，不再使用addrs
+func startCacheServer(addr string, addrs []string, registry string, gee *geecache.Group) {
 	peers := geecache.NewHTTPPool(addr)
-	peers.Set(addrs...)      //根据节点addrs，生成了所有节点addrs虚拟节点组成的hash环，并且为每一个实节点分配了一个http客户端！
-	gee.RegisterPeers(peers) //将分布式缓存的获取权注册给了gee
+	if registry != "" {
+		peers.Discover(registry, 0) //向注册中心注册自己，并定期从注册中心更新所有节点
+	} else {
+		peers.Set(addrs...) //根据节点addrs，生成了所有节点addrs虚拟节点组成的hash环，并且为每一个实节点分配了一个http客户端！
+	}
+	peers.HealthCheck(time.Second * 5) //定期检查其他节点是否健康，熔断的节点恢复之后尽快重新使用
+	gee.RegisterPeers(peers)           //将分布式缓存的获取权注册给了gee
 	log.Println("geecache is running at", addr)
 	log.Fatal(http.ListenAndServe(addr[7:], peers))
 }
@@ -47,7 +54,7 @@ func startAPIServer(apiAddr string, gee *geecache.Group) {
 	http.Handle("/api", http.HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
 			key := r.URL.Query().Get("key")
-			view, err := gee.Get(key) //获取key的缓存值
+			view, err := gee.GetContext(r.Context(), key) //获取key的缓存值，用户断开请求时不再继续获取
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
@@ -64,9 +71,11 @@ func startAPIServer(apiAddr string, gee *geecache.Group) {
 func main() {
 	var port int
 	var api bool
-	flag.IntVar(&port, "port", 8001, "Geecache server port") //注册命令行参数格式
-	flag.BoolVar(&api, "api", false, "Start a api server?")  //注册命令行参数格式
-	flag.Parse()                                             //解析
+	var registry string
+	flag.IntVar(&port, "port", 8001, "Geecache server port")                                //注册命令行参数格式
+	flag.BoolVar(&api, "api", false, "Start a api server?")                                 //注册命令行参数格式
+	flag.StringVar(&registry, "registry", "", "geerpc registry address for peer discovery") //注册命令行参数格式
+	flag.Parse()                                                                            //解析
 
 	apiAddr := "http://localhost:9999" //用户获取缓存数据，通过此url
 	addrMap := map[int]string{         //分布式缓存三个节点服务端
@@ -85,7 +94,7 @@ func main() {
 		go startAPIServer(apiAddr, gee) //开启一个为用户查询缓存数据的服务！
 	}
 	//根据命令行参数，分别使用addrMap下的三个端开启三个服务端，这三个服务用户是看不到的
-	startCacheServer(addrMap[port], []string(addrs), gee)
+	startCacheServer(addrMap[port], []string(addrs), registry, gee)
 }
 
 type good interface {